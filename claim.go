@@ -0,0 +1,278 @@
+package main
+
+// Work-item claiming (TODO 009).
+//
+// A claim of <item> by <who> is the branch claims/<item>/<who> pushed to a
+// remote. Each claimant owns their own ref, so claims work with a shared
+// coordination remote and with per-fork remotes alike. Claim state is always
+// evaluated after fetching every configured remote, so collisions across
+// forks are visible; pushes use --force-with-lease so a concurrent change to a
+// claim ref makes the push fail instead of silently overwriting it.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stevegt/mob-consensus/consensus"
+)
+
+// claimant returns the label a claim is recorded under: --who, else <user>.
+func claimant(opts options, user string) string {
+	if who := strings.TrimSpace(opts.who); who != "" {
+		return who
+	}
+	return user
+}
+
+// validateClaim checks that item and who form a valid claim branch name.
+func validateClaim(ctx context.Context, g consensus.Git, item, who string) error {
+	if item == "" {
+		return errors.New("mob-consensus: claim item is empty")
+	}
+	if strings.Contains(who, "/") {
+		return fmt.Errorf("mob-consensus: invalid claimant %q (must not contain '/')", who)
+	}
+	return validateBranchName(ctx, g, "claim", consensus.ClaimBranch(item, who))
+}
+
+// fetchClaims fetches the claim refs of each remote (pruning claims that were
+// dropped), then lists them.
+func fetchClaims(ctx context.Context, g consensus.Git, remotes []string) ([]consensus.Claim, error) {
+	for _, remote := range remotes {
+		if err := g.Run(ctx, "fetch", "--prune", remote, consensus.ClaimFetchRefspec(remote)); err != nil {
+			return nil, err
+		}
+	}
+	return consensus.Runner{Git: g}.Claims(ctx, remotes...)
+}
+
+// claimLease returns a --force-with-lease option that only lets a push change
+// the claim ref if it still points at tip ("" means it must not exist).
+func claimLease(item, who, tip string) string {
+	return "--force-with-lease=" + consensus.ClaimRef(item, who) + ":" + tip
+}
+
+// describeClaims formats claims as "bob (on origin), carol (on carol)".
+func describeClaims(claims []consensus.Claim) string {
+	var parts []string
+	for _, c := range claims {
+		parts = append(parts, fmt.Sprintf("%s (on %s)", c.Who, c.Remote))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runClaim implements `mob-consensus claim ITEM`.
+//
+// It fetches all remotes, refuses to claim an item somebody else holds unless
+// opts.steal is set, then pushes a fresh claim commit (see
+// consensus.Runner.ClaimCommit) to claims/<item>/<who> on the selected remote. With --steal, other claims on the selected remote are deleted in the
+// same atomic push; claims on other remotes can't be removed from here and are
+// reported as collisions.
+func runClaim(ctx context.Context, g consensus.Git, opts options, user string, stdout, stderr io.Writer) error {
+	item := strings.TrimSpace(opts.item)
+	who := claimant(opts, user)
+	if err := validateClaim(ctx, g, item, who); err != nil {
+		return usageError{Err: err}
+	}
+
+	remote, err := resolveRemote(ctx, g, cmdClaim, opts, stderr)
+	if err != nil {
+		return usageError{Err: err}
+	}
+	remotes, err := consensus.Runner{Git: g}.Remotes(ctx)
+	if err != nil {
+		return err
+	}
+	claims, err := fetchClaims(ctx, g, remotes)
+	if err != nil {
+		return err
+	}
+
+	mineTip := ""
+	var stolen, elsewhere []consensus.Claim
+	for _, c := range claims {
+		switch {
+		case c.Item != item:
+		case c.Who == who && c.Remote == remote:
+			mineTip = c.Tip
+		case c.Who == who:
+		case c.Remote == remote:
+			stolen = append(stolen, c)
+		default:
+			elsewhere = append(elsewhere, c)
+		}
+	}
+	if others := append(append([]consensus.Claim(nil), stolen...), elsewhere...); len(others) > 0 && !opts.steal {
+		return fmt.Errorf("mob-consensus: %s is already claimed by %s (hint: coordinate with them, or take it over with `mob-consensus claim %s --steal`)", item, describeClaims(others), item)
+	}
+
+	commit, err := consensus.Runner{Git: g}.ClaimCommit(ctx, item, who)
+	if err != nil {
+		return err
+	}
+	args := []string{"push", claimLease(item, who, mineTip)}
+	if len(stolen) > 0 {
+		args = append(args, "--atomic")
+	}
+	for _, c := range stolen {
+		args = append(args, claimLease(c.Item, c.Who, c.Tip))
+	}
+	args = append(args, remote, commit+":"+consensus.ClaimRef(item, who))
+	for _, c := range stolen {
+		args = append(args, ":"+consensus.ClaimRef(c.Item, c.Who))
+	}
+	if err := checkPushPolicy(ctx, g, args); err != nil {
+		return err
+	}
+	if err := g.Run(ctx, args...); err != nil {
+		return fmt.Errorf("mob-consensus: claim push to %s failed (hint: a claim may have changed concurrently; run `mob-consensus claims` and retry): %w", remote, err)
+	}
+
+	verb := "Claimed"
+	if mineTip != "" {
+		verb = "Renewed claim on"
+	}
+	fmt.Fprintf(stdout, "%s %s as %s on %s\n", verb, item, who, remote)
+	for _, c := range stolen {
+		fmt.Fprintf(stdout, "Removed %s's claim on %s\n", c.Who, c.Remote)
+	}
+	for _, c := range elsewhere {
+		fmt.Fprintf(stderr, "mob-consensus: collision: %s is also claimed by %s on %s (hint: ask them to run `mob-consensus unclaim %s`)\n", item, c.Who, c.Remote, item)
+	}
+	return nil
+}
+
+// runUnclaim implements `mob-consensus unclaim ITEM`. It deletes
+// claims/<item>/<who> on the selected remote. Removing a claim recorded under
+// a label other than <user> requires opts.steal.
+func runUnclaim(ctx context.Context, g consensus.Git, opts options, user string, stdout, stderr io.Writer) error {
+	item := strings.TrimSpace(opts.item)
+	who := claimant(opts, user)
+	if err := validateClaim(ctx, g, item, who); err != nil {
+		return usageError{Err: err}
+	}
+	if who != user && !opts.steal {
+		return usageError{Err: fmt.Errorf("mob-consensus: refusing to remove %s's claim on %s (hint: pass --steal to remove someone else's claim)", who, item)}
+	}
+
+	remote, err := resolveRemote(ctx, g, cmdUnclaim, opts, stderr)
+	if err != nil {
+		return usageError{Err: err}
+	}
+	claims, err := fetchClaims(ctx, g, []string{remote})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range claims {
+		if c.Item != item || c.Who != who {
+			continue
+		}
+		args := []string{"push", claimLease(item, who, c.Tip), remote, ":" + consensus.ClaimRef(item, who)}
+		if err := checkPushPolicy(ctx, g, args); err != nil {
+			return err
+		}
+		if err := g.Run(ctx, args...); err != nil {
+			return fmt.Errorf("mob-consensus: unclaim push to %s failed (hint: the claim may have changed concurrently; run `mob-consensus claims` and retry): %w", remote, err)
+		}
+		fmt.Fprintf(stdout, "Released %s (claimed by %s) on %s\n", item, who, remote)
+		return nil
+	}
+	return fmt.Errorf("mob-consensus: %s is not claimed by %s on %s (hint: mob-consensus claims)", item, who, remote)
+}
+
+// runClaims implements `mob-consensus claims`. It fetches claim refs from
+// every remote (or only --remote), prints one line per claim with its age, and
+// lists items claimed by more than one person.
+func runClaims(ctx context.Context, g consensus.Git, opts options, stdout, stderr io.Writer) error {
+	remotes, err := consensus.Runner{Git: g}.Remotes(ctx)
+	if err != nil {
+		return err
+	}
+	if len(remotes) == 0 {
+		return errors.New("mob-consensus: no remotes configured (hint: git remote -v)")
+	}
+	if strings.TrimSpace(opts.remote) != "" {
+		remote, err := resolveRemote(ctx, g, cmdClaims, opts, stderr)
+		if err != nil {
+			return usageError{Err: err}
+		}
+		remotes = []string{remote}
+	}
+
+	claims, err := fetchClaims(ctx, g, remotes)
+	if err != nil {
+		return err
+	}
+	if item := strings.TrimSpace(opts.item); item != "" {
+		var filtered []consensus.Claim
+		for _, c := range claims {
+			if c.Item == item {
+				filtered = append(filtered, c)
+			}
+		}
+		claims = filtered
+	}
+
+	if len(claims) == 0 {
+		fmt.Fprintln(stdout, "No claims.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ITEM\tWHO\tREMOTE\tAGE\tTIP")
+	now := time.Now()
+	for _, c := range claims {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Item, c.Who, c.Remote, formatAge(now.Sub(c.Date)), shortSHA(c.Tip))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	collisions := consensus.ClaimCollisions(claims)
+	if len(collisions) == 0 {
+		return nil
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, "Collisions (claimed by more than one person):")
+	seen := map[string]bool{}
+	for _, c := range claims {
+		if seen[c.Item] || collisions[c.Item] == nil {
+			continue
+		}
+		seen[c.Item] = true
+		fmt.Fprintf(stdout, "  %s: %s\n", c.Item, describeClaims(collisions[c.Item]))
+	}
+	return nil
+}
+
+// formatAge renders d coarsely (ex: "45s", "12m", "3h", "5d") for listings
+// where a rough age is enough to spot stale work.
+func formatAge(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// shortSHA abbreviates a full commit SHA for display.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
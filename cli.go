@@ -6,15 +6,19 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/stevegt/mob-consensus/consensus"
 )
 
 // This file defines the CLI surface area using Cobra.
 //
 // The design goal is to keep parsing, command routing, and help/usage wiring
-// here, while leaving the Git-centric workflow logic in main.go so it can be
-// exercised by integration tests (without spawning a separate binary).
+// here, while leaving the Git-centric workflow logic in main.go (and siblings
+// such as claim.go) so it can be exercised by integration tests (without
+// spawning a separate binary).
 //
 // TODO 015 hard breaks are implemented as explicit verbs:
 //   - `mob-consensus status` (no "no-args discovery")
@@ -22,9 +26,14 @@ import (
 //   - `mob-consensus branch create <twig>` (no `-b` flag)
 
 // run is the main CLI entrypoint used by mainExit. It executes the Cobra root
-// command with the provided args and I/O streams.
-func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
-	root := newRootCmd(stdout, stderr)
+// command with the provided args and I/O streams; every git command goes
+// through g. Prompts read their answers from stdin; a nil stdin has no input,
+// so every prompt gets its default answer.
+func run(ctx context.Context, g consensus.Git, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	root := newRootCmd(g, stdin, stdout, stderr)
 	root.SetArgs(args)
 	root.SetContext(ctx)
 	if err := root.ExecuteContext(ctx); err != nil {
@@ -42,6 +51,20 @@ func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
 	return nil
 }
 
+// cmdUser returns the <user> prefix (see consensus.Runner.User). A roster
+// that can't be loaded doesn't stop the command: the prefix falls back to
+// user.email, with a warning on the command's stderr. `team sync` still
+// fails on it.
+func cmdUser(cmd *cobra.Command, g consensus.Git) (string, error) {
+	user, err := consensus.Runner{Git: g}.User(cmd.Context())
+	var warning consensus.TeamFileWarning
+	if errors.As(err, &warning) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "mob-consensus: warning: ignoring %s (%v); using <user> %q from user.email (hint: fix the file; `mob-consensus team sync` reports the same error)\n", consensus.TeamFile, warning.Err, user)
+		return user, nil
+	}
+	return user, err
+}
+
 // isCobraUsageError returns true for errors that should be treated as "show
 // usage" errors.
 //
@@ -69,7 +92,7 @@ func isCobraUsageError(err error) bool {
 //
 // Help/usage rendering is delegated to printUsage() so the user-facing text is
 // maintained as a single template (usage.tmpl).
-func newRootCmd(stdout, stderr io.Writer) *cobra.Command {
+func newRootCmd(g consensus.Git, stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 	var (
 		force       bool
 		noPush      bool
@@ -86,6 +109,7 @@ func newRootCmd(stdout, stderr io.Writer) *cobra.Command {
 			return usageError{Err: errors.New("mob-consensus: missing command (hint: run `mob-consensus -h`)")}
 		},
 	}
+	cmd.SetIn(stdin)
 	cmd.SetOut(stdout)
 	cmd.SetErr(stderr)
 
@@ -93,34 +117,55 @@ func newRootCmd(stdout, stderr io.Writer) *cobra.Command {
 		return usageError{Err: err}
 	})
 	cmd.SetHelpFunc(func(cmd *cobra.Command, _ []string) {
-		if err := printUsage(cmd.Context(), cmd.OutOrStdout()); err != nil {
+		if err := printUsage(cmd.Context(), g, cmd.OutOrStdout()); err != nil {
 			printError(cmd.ErrOrStderr(), err)
 		}
 	})
 	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
-		return printUsage(cmd.Context(), cmd.OutOrStdout())
+		return printUsage(cmd.Context(), g, cmd.OutOrStdout())
 	})
 
-	cmd.PersistentFlags().BoolVarP(&force, "force", "F", false, "force run even if not on a <user>/ branch")
+	cmd.PersistentFlags().BoolVarP(&force, "force", "F", false, "force run even if not on your personal branch")
 	cmd.PersistentFlags().BoolVarP(&commitDirty, "commit-dirty", "c", false, "commit existing uncommitted changes")
 	cmd.PersistentFlags().BoolVarP(&noPush, "no-push", "n", false, "no automatic push after commits")
 
-	cmd.AddCommand(newStatusCmd(&force, &noPush, &commitDirty))
-	cmd.AddCommand(newBranchCmd(&noPush, &commitDirty))
-	cmd.AddCommand(newMergeCmd(&force, &noPush, &commitDirty))
-	cmd.AddCommand(newInitCmd(&commitDirty))
-	cmd.AddCommand(newStartCmd(&commitDirty))
-	cmd.AddCommand(newJoinCmd(&commitDirty))
+	cmd.AddCommand(newStatusCmd(g, &force, &noPush, &commitDirty))
+	cmd.AddCommand(newBranchCmd(g, &noPush, &commitDirty))
+	cmd.AddCommand(newMergeCmd(g, &force, &noPush, &commitDirty))
+	cmd.AddCommand(newSyncCmd(g, &force, &noPush, &commitDirty))
+	cmd.AddCommand(newInitCmd(g, &commitDirty))
+	cmd.AddCommand(newStartCmd(g, &commitDirty))
+	cmd.AddCommand(newJoinCmd(g, &commitDirty))
+	cmd.AddCommand(newFinishCmd(g, &force, &commitDirty))
+	cmd.AddCommand(newClaimCmd(g))
+	cmd.AddCommand(newUnclaimCmd(g))
+	cmd.AddCommand(newClaimsCmd(g))
+	cmd.AddCommand(newTeamCmd(g))
+	cmd.AddCommand(newTwigCmd(g))
+	cmd.AddCommand(newTUICmd(g, &force, &noPush, &commitDirty))
 
 	return cmd
 }
 
+// cmdConsole connects prompts to cmd's stdin and stderr.
+func cmdConsole(cmd *cobra.Command) console {
+	return newConsole(cmd.InOrStdin(), cmd.ErrOrStderr())
+}
+
 // newStatusCmd implements `mob-consensus status`.
-func newStatusCmd(force, noPush, commitDirty *bool) *cobra.Command {
+func newStatusCmd(g consensus.Git, force, noPush, commitDirty *bool) *cobra.Command {
+	var format string
+	var matrix, noFetch bool
+	var stale time.Duration
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Fetch and list related branches for the current twig",
-		Long:  "Fetch remote refs, then list related branches ending in */<twig> and show whether each is ahead/behind/diverged/synced.",
+		Long: "Fetch remote refs, then list related branches ending in */<twig> and show whether each is ahead/behind/diverged/synced, " +
+			"with commit counts both ways and the tip commit's author, age, and subject.\n\n" +
+			"Use --stale DURATION (ex: 72h) to flag peers with no commits in that window.\n\n" +
+			"The output ends with the age of each remote's last fetch. --no-fetch (or mob-consensus.allowOffline when fetching fails) works from the local remote-tracking refs.\n\n" +
+			"Use --format json (one document) or --format ndjson (one line per branch) for machine-readable output with a versioned schema.\n\n" +
+			"With --matrix, compare every pair of related branches (including the current one) and report whether consensus is reached: every branch has the same content. --matrix supports text and json output.",
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) > 0 {
 				return usageError{Err: fmt.Errorf("unexpected argument: %s", args[0])}
@@ -132,84 +177,267 @@ func newStatusCmd(force, noPush, commitDirty *bool) *cobra.Command {
 				force:       *force,
 				noPush:      *noPush,
 				commitDirty: *commitDirty,
+				format:      format,
+				matrix:      matrix,
+				stale:       stale,
+				noFetch:     noFetch,
+				console:     cmdConsole(cmd),
+			}
+			if err := validateStatusFormat(opts); err != nil {
+				return err
+			}
+			switch {
+			case stale < 0:
+				return usageError{Err: errors.New("--stale must be a positive duration (ex: 72h)")}
+			case stale > 0 && matrix:
+				return usageError{Err: errors.New("--stale cannot be combined with --matrix")}
 			}
 
-			currentBranch, err := gitOutputTrimmed(cmd.Context(), "rev-parse", "--abbrev-ref", "HEAD")
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
 			if err != nil {
 				return err
 			}
-			user, err := branchUserFromEmail(cmd.Context())
+			user, err := cmdUser(cmd, g)
 			if err != nil {
 				return err
 			}
 
-			if err := requireUserBranch(opts.force, user, currentBranch); err != nil {
+			naming, err := consensus.Runner{Git: g}.Naming(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := requireUserBranch(opts.force, naming, user, currentBranch); err != nil {
 				return usageError{Err: err}
 			}
-			if err := fetchSuggestedRemote(cmd.Context(), ""); err != nil {
+			fetched, err := fetchRelated(cmd.Context(), g, opts, "", cmd.ErrOrStderr())
+			if err != nil {
 				return err
 			}
-			return runDiscovery(cmd.Context(), opts, currentBranch, cmd.OutOrStdout())
+			opts.noFetch = !fetched
+			return runDiscovery(cmd.Context(), g, opts, currentBranch, cmd.OutOrStdout())
 		},
 	}
+	cmd.Flags().StringVar(&format, "format", formatText, "output format: text, json, or ndjson")
+	cmd.Flags().BoolVar(&matrix, "matrix", false, "compare every pair of related branches")
+	cmd.Flags().DurationVar(&stale, "stale", 0, "flag related branches with no commits in this long (ex: 72h)")
+	cmd.Flags().BoolVar(&noFetch, "no-fetch", false, "don't fetch; use the local remote-tracking refs")
 	return cmd
 }
 
+// validateStatusFormat rejects unknown formats, -c with machine-readable
+// output (auto-commit prints to stdout and opens an editor), and --matrix
+// with ndjson (a matrix has no natural one-line-per-branch form).
+func validateStatusFormat(opts options) error {
+	switch opts.format {
+	case formatText:
+		return nil
+	case formatJSON, formatNDJSON:
+		if opts.commitDirty {
+			return usageError{Err: fmt.Errorf("--format %s cannot be combined with -c", opts.format)}
+		}
+		if opts.matrix && opts.format == formatNDJSON {
+			return usageError{Err: errors.New("--matrix supports --format text or json, not ndjson")}
+		}
+		return nil
+	default:
+		return usageError{Err: fmt.Errorf("unknown --format %q (want text, json, or ndjson)", opts.format)}
+	}
+}
+
 // newMergeCmd implements `mob-consensus merge OTHER_BRANCH`.
-func newMergeCmd(force, noPush, commitDirty *bool) *cobra.Command {
+func newMergeCmd(g consensus.Git, force, noPush, commitDirty *bool) *cobra.Command {
+	var mergeTool, diffTool string
+	var noDiffTool, review, approve, noAssist, continueMerge, abortMerge, allRelated, noFetch bool
 	cmd := &cobra.Command{
-		Use:   "merge OTHER_BRANCH",
-		Short: "Merge a related branch onto the current branch",
+		Use:   "merge OTHER_BRANCH... | --all-related | --continue | --abort",
+		Short: "Merge related branches onto the current branch",
 		Long: "Merge OTHER_BRANCH onto the current branch, adding Co-authored-by trailers, opening tools for review/conflict resolution, then committing and (optionally) pushing.\n\n" +
-			"If OTHER_BRANCH isn't a local ref, mob-consensus will try to resolve it to <remote>/OTHER_BRANCH and ask for confirmation.",
-		Args: cobra.ExactArgs(1),
+			"If OTHER_BRANCH isn't a local ref, mob-consensus will try to resolve it to <remote>/OTHER_BRANCH and ask for confirmation.\n\n" +
+			"Tools: --mergetool, then mob-consensus.mergetool, then merge.tool, then vimdiff; --difftool, then mob-consensus.difftool, then diff.tool, then merge.tool, then vimdiff. " +
+			"mob-consensus.editor overrides git's editor for the merge commit. Missing tools fail before the merge starts; the mergetool is only required when the merge is predicted to conflict.\n\n" +
+			"--review (or mob-consensus.review=true) replaces difftool with a hunk-by-hunk approval loop; nothing is committed until every hunk is approved. " +
+			"Without a terminal every merge, with or without --review, prints the change set and stops with the merge in progress; approve it with --continue --approve (or pass --approve up front). --approve skips the interactive review on a terminal too.\n\n" +
+			"If mob-consensus.assistCommand is set, that command receives the merge (diff, conflicts, peer commits) as JSON on stdin and prints {\"summary\", \"body\"} JSON; the body is drafted into the merge message, which you still edit and approve.\n\n" +
+			"Progress is journaled under .git/mob-consensus/. If the merge is interrupted (mergetool fails, Ctrl-C, review quit, failed push), " +
+			"--continue resumes at the first unfinished step with the original flags, and --abort restores the pre-merge state.\n\n" +
+			"Several OTHER_BRANCHes (or --all-related, every related branch with changes you lack) are merged in one octopus merge commit whose Co-authored-by trailers cover every target. " +
+			"If git can't merge them all cleanly at once, they are merged one at a time instead, and pushed once at the end.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if continueMerge || abortMerge || allRelated {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := options{
+				force:         *force,
+				noPush:        *noPush,
+				commitDirty:   *commitDirty,
+				mergeTool:     mergeTool,
+				diffTool:      diffTool,
+				noDiffTool:    noDiffTool,
+				review:        review,
+				approve:       approve,
+				noAssist:      noAssist,
+				continueMerge: continueMerge,
+				abortMerge:    abortMerge,
+				noFetch:       noFetch,
+				console:       cmdConsole(cmd),
+			}
+			switch len(args) {
+			case 0:
+			case 1:
+				opts.otherBranch = args[0]
+			default:
+				opts.others = args
+			}
+
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
+			if err != nil {
+				return err
+			}
+			user, err := cmdUser(cmd, g)
+			if err != nil {
+				return err
+			}
+
+			naming, err := consensus.Runner{Git: g}.Naming(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := requireUserBranch(opts.force, naming, user, currentBranch); err != nil {
+				return usageError{Err: err}
+			}
+			if len(args) > 0 || allRelated {
+				if _, err := fetchRelated(cmd.Context(), g, opts, opts.otherBranch, cmd.ErrOrStderr()); err != nil {
+					return err
+				}
+			}
+			if allRelated {
+				d, err := consensus.Runner{Git: g}.Discover(cmd.Context(), currentBranch)
+				if err != nil {
+					return err
+				}
+				targets := d.MergeTargets(consensus.SyncFilter{})
+				switch len(targets) {
+				case 0:
+					fmt.Fprintln(cmd.OutOrStdout(), "Nothing to merge: no related branch has changes you lack.")
+					return nil
+				case 1:
+					opts.otherBranch = targets[0]
+				default:
+					opts.others = targets
+				}
+			}
+			return runMerge(cmd.Context(), g, opts, currentBranch, cmd.OutOrStdout())
+		},
+	}
+	cmd.Flags().StringVar(&mergeTool, "mergetool", "", "merge tool for conflicts (default: mob-consensus.mergetool, merge.tool, vimdiff)")
+	cmd.Flags().StringVar(&diffTool, "difftool", "", "diff tool for the pre-commit review (default: mob-consensus.difftool, diff.tool, merge.tool, vimdiff)")
+	cmd.Flags().BoolVar(&noDiffTool, "no-difftool", false, "skip the difftool review before committing")
+	cmd.Flags().BoolVar(&review, "review", false, "approve the merge result hunk by hunk instead of using difftool")
+	cmd.Flags().BoolVar(&approve, "approve", false, "approve the printed change set without the interactive review")
+	cmd.Flags().BoolVar(&noAssist, "no-assist", false, "don't run mob-consensus.assistCommand for this merge")
+	cmd.Flags().BoolVar(&allRelated, "all-related", false, "merge every related branch that has changes you lack (one octopus merge)")
+	cmd.Flags().BoolVar(&noFetch, "no-fetch", false, "don't fetch; use the local remote-tracking refs")
+	cmd.Flags().BoolVar(&continueMerge, "continue", false, "resume an interrupted mob-consensus merge")
+	cmd.Flags().BoolVar(&abortMerge, "abort", false, "abort an interrupted mob-consensus merge and restore the pre-merge state")
+	cmd.MarkFlagsMutuallyExclusive("difftool", "no-difftool")
+	cmd.MarkFlagsMutuallyExclusive("continue", "abort", "all-related")
+	// --continue reuses the journaled merge's flags; only --review and
+	// --approve may be added.
+	for _, f := range []string{"mergetool", "difftool", "no-difftool", "no-assist"} {
+		cmd.MarkFlagsMutuallyExclusive("continue", f)
+		cmd.MarkFlagsMutuallyExclusive("abort", f)
+	}
+	cmd.MarkFlagsMutuallyExclusive("abort", "review")
+	cmd.MarkFlagsMutuallyExclusive("abort", "approve")
+	return cmd
+}
+
+// newSyncCmd implements `mob-consensus sync`.
+func newSyncCmd(g consensus.Git, force, noPush, commitDirty *bool) *cobra.Command {
+	var only, skip []string
+	var mergeTool, diffTool string
+	var noDiffTool, review, approve, noAssist, noFetch bool
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Merge every peer that has changes you lack, then push once",
+		Long: "Fetch, list related branches like `status`, then merge each ahead or diverged peer onto the current branch through the regular merge flow, one at a time, and push once at the end.\n\n" +
+			"--only and --skip take <user> labels or branch names (comma-separated or repeated). " +
+			"sync stops at the first conflicting merge and leaves it in progress: resolve it with `mob-consensus merge --continue`, then re-run sync for the remaining peers.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
 			opts := options{
 				force:       *force,
 				noPush:      *noPush,
 				commitDirty: *commitDirty,
-				otherBranch: args[0],
+				mergeTool:   mergeTool,
+				diffTool:    diffTool,
+				noDiffTool:  noDiffTool,
+				review:      review,
+				approve:     approve,
+				noAssist:    noAssist,
+				only:        only,
+				skip:        skip,
+				noFetch:     noFetch,
+				console:     cmdConsole(cmd),
 			}
 
-			currentBranch, err := gitOutputTrimmed(cmd.Context(), "rev-parse", "--abbrev-ref", "HEAD")
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
 			if err != nil {
 				return err
 			}
-			user, err := branchUserFromEmail(cmd.Context())
+			user, err := cmdUser(cmd, g)
 			if err != nil {
 				return err
 			}
 
-			if err := requireUserBranch(opts.force, user, currentBranch); err != nil {
+			naming, err := consensus.Runner{Git: g}.Naming(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := requireUserBranch(opts.force, naming, user, currentBranch); err != nil {
 				return usageError{Err: err}
 			}
-			if err := fetchSuggestedRemote(cmd.Context(), opts.otherBranch); err != nil {
+			if _, err := fetchRelated(cmd.Context(), g, opts, "", cmd.ErrOrStderr()); err != nil {
 				return err
 			}
-			return runMerge(cmd.Context(), opts, currentBranch, cmd.OutOrStdout())
+			return runSync(cmd.Context(), g, opts, currentBranch, cmd.OutOrStdout())
 		},
 	}
+	cmd.Flags().StringSliceVar(&only, "only", nil, "merge only these peers (<user> labels or branch names)")
+	cmd.Flags().StringSliceVar(&skip, "skip", nil, "don't merge these peers (<user> labels or branch names)")
+	cmd.Flags().StringVar(&mergeTool, "mergetool", "", "merge tool that merge --continue opens after a conflict (default: mob-consensus.mergetool, merge.tool, vimdiff)")
+	cmd.Flags().StringVar(&diffTool, "difftool", "", "diff tool for the review before each commit (default: mob-consensus.difftool, diff.tool, merge.tool, vimdiff)")
+	cmd.Flags().BoolVar(&noDiffTool, "no-difftool", false, "skip the difftool review before each commit")
+	cmd.Flags().BoolVar(&review, "review", false, "approve each merge result hunk by hunk instead of using difftool")
+	cmd.Flags().BoolVar(&approve, "approve", false, "approve each printed change set without the interactive review")
+	cmd.Flags().BoolVar(&noAssist, "no-assist", false, "don't run mob-consensus.assistCommand")
+	cmd.Flags().BoolVar(&noFetch, "no-fetch", false, "don't fetch; use the local remote-tracking refs")
+	cmd.MarkFlagsMutuallyExclusive("difftool", "no-difftool")
 	return cmd
 }
 
 // newBranchCmd groups branch-related helpers under `mob-consensus branch ...`.
-func newBranchCmd(noPush, commitDirty *bool) *cobra.Command {
+func newBranchCmd(g consensus.Git, noPush, commitDirty *bool) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "branch",
 		Short: "Branch helpers",
 		Args:  cobra.NoArgs,
 	}
-	cmd.AddCommand(newBranchCreateCmd(noPush, commitDirty))
+	cmd.AddCommand(newBranchCreateCmd(g, noPush, commitDirty))
 	return cmd
 }
 
 // newBranchCreateCmd implements `mob-consensus branch create TWIG`.
 //
-// The created personal branch name is derived from `git config user.email`.
+// The created personal branch name uses the <user> label (see
+// consensus.Runner.UserLabel).
 // The base ref is either:
 //   - the explicit --from ref (which may be "HEAD"), or
 //   - the current branch name (when not detached).
-func newBranchCreateCmd(noPush, commitDirty *bool) *cobra.Command {
+func newBranchCreateCmd(g consensus.Git, noPush, commitDirty *bool) *cobra.Command {
 	var fromRef string
 	cmd := &cobra.Command{
 		Use:   "create TWIG",
@@ -219,11 +447,11 @@ func newBranchCreateCmd(noPush, commitDirty *bool) *cobra.Command {
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			twig := args[0]
-			if err := validateBranchName(cmd.Context(), "twig", twig); err != nil {
+			if err := validateBranchName(cmd.Context(), g, "twig", twig); err != nil {
 				return usageError{Err: err}
 			}
 
-			currentBranch, err := gitOutputTrimmed(cmd.Context(), "rev-parse", "--abbrev-ref", "HEAD")
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
 			if err != nil {
 				return err
 			}
@@ -245,7 +473,7 @@ func newBranchCreateCmd(noPush, commitDirty *bool) *cobra.Command {
 				return usageError{Err: errors.New("mob-consensus: could not determine a base ref (hint: pass --from <ref>)")}
 			}
 
-			user, err := branchUserFromEmail(cmd.Context())
+			user, err := cmdUser(cmd, g)
 			if err != nil {
 				return err
 			}
@@ -255,8 +483,9 @@ func newBranchCreateCmd(noPush, commitDirty *bool) *cobra.Command {
 				commitDirty: *commitDirty,
 				twig:        twig,
 				base:        baseRef,
+				console:     cmdConsole(cmd),
 			}
-			return runCreateBranch(cmd.Context(), opts, user, cmd.OutOrStdout())
+			return runCreateBranch(cmd.Context(), g, opts, user, cmd.OutOrStdout())
 		},
 	}
 	cmd.Flags().StringVar(&fromRef, "from", "", "base ref (default: current branch)")
@@ -293,7 +522,7 @@ func validateOnboardingFlags(flags onboardingFlags) error {
 }
 
 // newInitCmd implements `mob-consensus init`.
-func newInitCmd(commitDirty *bool) *cobra.Command {
+func newInitCmd(g consensus.Git, commitDirty *bool) *cobra.Command {
 	var flags onboardingFlags
 	cmd := &cobra.Command{
 		Use:   "init",
@@ -304,11 +533,11 @@ func newInitCmd(commitDirty *bool) *cobra.Command {
 				return err
 			}
 
-			currentBranch, err := gitOutputTrimmed(cmd.Context(), "rev-parse", "--abbrev-ref", "HEAD")
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
 			if err != nil {
 				return err
 			}
-			user, err := branchUserFromEmail(cmd.Context())
+			user, err := cmdUser(cmd, g)
 			if err != nil {
 				return err
 			}
@@ -321,8 +550,9 @@ func newInitCmd(commitDirty *bool) *cobra.Command {
 				plan:        flags.plan,
 				dryRun:      flags.dryRun,
 				yes:         flags.yes,
+				console:     cmdConsole(cmd),
 			}
-			return runInit(cmd.Context(), opts, user, currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
+			return runInit(cmd.Context(), g, opts, user, currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
 		},
 	}
 	addOnboardingFlags(cmd, &flags, true)
@@ -330,7 +560,7 @@ func newInitCmd(commitDirty *bool) *cobra.Command {
 }
 
 // newStartCmd implements `mob-consensus start`.
-func newStartCmd(commitDirty *bool) *cobra.Command {
+func newStartCmd(g consensus.Git, commitDirty *bool) *cobra.Command {
 	var flags onboardingFlags
 	cmd := &cobra.Command{
 		Use:   "start",
@@ -341,11 +571,11 @@ func newStartCmd(commitDirty *bool) *cobra.Command {
 				return err
 			}
 
-			currentBranch, err := gitOutputTrimmed(cmd.Context(), "rev-parse", "--abbrev-ref", "HEAD")
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
 			if err != nil {
 				return err
 			}
-			user, err := branchUserFromEmail(cmd.Context())
+			user, err := cmdUser(cmd, g)
 			if err != nil {
 				return err
 			}
@@ -358,8 +588,9 @@ func newStartCmd(commitDirty *bool) *cobra.Command {
 				plan:        flags.plan,
 				dryRun:      flags.dryRun,
 				yes:         flags.yes,
+				console:     cmdConsole(cmd),
 			}
-			return runStart(cmd.Context(), opts, user, currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
+			return runStart(cmd.Context(), g, opts, user, currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
 		},
 	}
 	addOnboardingFlags(cmd, &flags, true)
@@ -367,7 +598,7 @@ func newStartCmd(commitDirty *bool) *cobra.Command {
 }
 
 // newJoinCmd implements `mob-consensus join`.
-func newJoinCmd(commitDirty *bool) *cobra.Command {
+func newJoinCmd(g consensus.Git, commitDirty *bool) *cobra.Command {
 	var flags onboardingFlags
 	cmd := &cobra.Command{
 		Use:   "join",
@@ -378,11 +609,11 @@ func newJoinCmd(commitDirty *bool) *cobra.Command {
 				return err
 			}
 
-			currentBranch, err := gitOutputTrimmed(cmd.Context(), "rev-parse", "--abbrev-ref", "HEAD")
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
 			if err != nil {
 				return err
 			}
-			user, err := branchUserFromEmail(cmd.Context())
+			user, err := cmdUser(cmd, g)
 			if err != nil {
 				return err
 			}
@@ -394,10 +625,314 @@ func newJoinCmd(commitDirty *bool) *cobra.Command {
 				plan:        flags.plan,
 				dryRun:      flags.dryRun,
 				yes:         flags.yes,
+				console:     cmdConsole(cmd),
 			}
-			return runJoin(cmd.Context(), opts, user, currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
+			return runJoin(cmd.Context(), g, opts, user, currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
 		},
 	}
 	addOnboardingFlags(cmd, &flags, false)
 	return cmd
 }
+
+// newFinishCmd implements `mob-consensus finish`.
+func newFinishCmd(g consensus.Git, force, commitDirty *bool) *cobra.Command {
+	var flags onboardingFlags
+	var mergeBase, noFetch bool
+	cmd := &cobra.Command{
+		Use:   "finish",
+		Short: "Land the consensus on the shared twig (and optionally the base branch)",
+		Long: "Fetch, check that every related branch is synced with your branch (as `status` shows), then fast-forward or merge the shared twig to your branch and push it.\n\n" +
+			"With --base BRANCH, also check that the twig merges cleanly into BRANCH and suggest a pull request; add --merge to merge the twig into BRANCH and push it instead (refused before any step runs if that merge would conflict).\n\n" +
+			"Like start/join, --plan prints the steps, --dry-run prints the commands, and --yes runs without prompts. Steps that are already done are skipped, so finish can be re-run.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := validateOnboardingFlags(flags); err != nil {
+				return err
+			}
+			if mergeBase && strings.TrimSpace(flags.base) == "" {
+				return usageError{Err: errors.New("--merge requires --base")}
+			}
+
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
+			if err != nil {
+				return err
+			}
+			user, err := cmdUser(cmd, g)
+			if err != nil {
+				return err
+			}
+			naming, err := consensus.Runner{Git: g}.Naming(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := requireUserBranch(*force, naming, user, currentBranch); err != nil {
+				return usageError{Err: err}
+			}
+
+			opts := options{
+				commitDirty: *commitDirty,
+				base:        flags.base,
+				remote:      flags.remote,
+				mergeBase:   mergeBase,
+				plan:        flags.plan,
+				dryRun:      flags.dryRun,
+				yes:         flags.yes,
+				noFetch:     noFetch,
+				console:     cmdConsole(cmd),
+			}
+			if _, err := fetchRelated(cmd.Context(), g, opts, "", cmd.ErrOrStderr()); err != nil {
+				return err
+			}
+			return runFinish(cmd.Context(), g, opts, user, currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	cmd.Flags().StringVar(&flags.base, "base", "", "base branch the twig lands on (ex: main)")
+	cmd.Flags().BoolVar(&mergeBase, "merge", false, "merge the twig into --base and push it, instead of suggesting a pull request")
+	cmd.Flags().StringVar(&flags.remote, "remote", "", "remote name to push to")
+	cmd.Flags().BoolVar(&flags.plan, "plan", false, "print the plan (commands + explanations) and exit")
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "print commands only; no prompts or execution")
+	cmd.Flags().BoolVar(&flags.yes, "yes", false, "accept defaults and run non-interactively")
+	cmd.Flags().BoolVar(&noFetch, "no-fetch", false, "don't fetch; use the local remote-tracking refs")
+	return cmd
+}
+
+// newTwigCmd groups the subcommands that act on a whole twig.
+func newTwigCmd(g consensus.Git) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "twig",
+		Short: "Whole-twig helpers",
+		Args:  cobra.NoArgs,
+	}
+	cmd.AddCommand(newTwigListCmd(g))
+	cmd.AddCommand(newTwigArchiveCmd(g))
+	return cmd
+}
+
+// newTwigListCmd implements `mob-consensus twig list`.
+func newTwigListCmd(g consensus.Git) *cobra.Command {
+	var format string
+	var noFetch bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List twigs with their participants, last activity, and shared twig branch",
+		Long: "Fetch, then group every local and remote <user>/<twig> branch by twig, most recently active first. " +
+			"Each twig shows its participants (the <user> prefixes), its number of personal branches, the age and author of its newest commit, and where the shared twig branch exists (locally and on which remotes).\n\n" +
+			"Use --format json for machine-readable output with a versioned schema.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if format != formatText && format != formatJSON {
+				return usageError{Err: fmt.Errorf("unknown --format %q (want text or json)", format)}
+			}
+			opts := options{format: format, noFetch: noFetch, console: cmdConsole(cmd)}
+			if _, err := fetchRelated(cmd.Context(), g, opts, "", cmd.ErrOrStderr()); err != nil {
+				return err
+			}
+			return runTwigList(cmd.Context(), g, opts, cmd.OutOrStdout())
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", formatText, "output format: text or json")
+	cmd.Flags().BoolVar(&noFetch, "no-fetch", false, "don't fetch; use the local remote-tracking refs")
+	return cmd
+}
+
+// newTwigArchiveCmd implements `mob-consensus twig archive TWIG`.
+func newTwigArchiveCmd(g consensus.Git) *cobra.Command {
+	var flags onboardingFlags
+	var noFetch bool
+	cmd := &cobra.Command{
+		Use:   "archive TWIG",
+		Short: "Tag a finished twig and delete its <user>/<twig> branches",
+		Long: "Fetch, tag the shared twig's tip as " + archiveTagPrefix + "TWIG and push the tag, then delete every local <user>/TWIG branch and every remote one on a remote the push policy allows. " +
+			"Refuses while any <user>/TWIG branch has commits the twig lacks. Branches it couldn't delete (other remotes, or the remote refused) are listed at the end; the shared twig itself is kept.\n\n" +
+			"Like start/join, --plan prints the steps, --dry-run prints the commands, and --yes runs without prompts.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOnboardingFlags(flags); err != nil {
+				return err
+			}
+			currentBranch, err := gitOutputTrimmed(cmd.Context(), g, "rev-parse", "--abbrev-ref", "HEAD")
+			if err != nil {
+				return err
+			}
+			opts := options{
+				remote:  flags.remote,
+				plan:    flags.plan,
+				dryRun:  flags.dryRun,
+				yes:     flags.yes,
+				noFetch: noFetch,
+				console: cmdConsole(cmd),
+			}
+			if _, err := fetchRelated(cmd.Context(), g, opts, "", cmd.ErrOrStderr()); err != nil {
+				return err
+			}
+			return runTwigArchive(cmd.Context(), g, opts, strings.TrimSpace(args[0]), currentBranch, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	cmd.Flags().StringVar(&flags.remote, "remote", "", "remote name to push the tag to")
+	cmd.Flags().BoolVar(&flags.plan, "plan", false, "print the plan (commands + explanations) and exit")
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "print commands only; no prompts or execution")
+	cmd.Flags().BoolVar(&flags.yes, "yes", false, "accept defaults and run non-interactively")
+	cmd.Flags().BoolVar(&noFetch, "no-fetch", false, "don't fetch; use the local remote-tracking refs")
+	return cmd
+}
+
+type claimFlags struct {
+	remote string
+	who    string
+	steal  bool
+	yes    bool
+}
+
+// addClaimFlags adds the shared claim/unclaim flags to cmd.
+func addClaimFlags(cmd *cobra.Command, flags *claimFlags, stealHelp string) {
+	cmd.Flags().StringVar(&flags.remote, "remote", "", "remote that holds the claim ref")
+	cmd.Flags().StringVar(&flags.who, "who", "", "claimant label (default: <user>)")
+	cmd.Flags().BoolVar(&flags.steal, "steal", false, stealHelp)
+	cmd.Flags().BoolVar(&flags.yes, "yes", false, "run non-interactively (requires an unambiguous remote)")
+}
+
+// newClaimCmd implements `mob-consensus claim ITEM`.
+func newClaimCmd(g consensus.Git) *cobra.Command {
+	var flags claimFlags
+	cmd := &cobra.Command{
+		Use:   "claim ITEM",
+		Short: "Claim a work item by pushing claims/ITEM/<user> to a remote",
+		Long: "Fetch claim refs from every remote, then record your claim of ITEM as the branch claims/ITEM/<user> on the selected remote. The branch points at a new empty commit, \"claim ITEM by <user>\", dated now. Claiming an item you already hold renews it.\n\n" +
+			"Refuses to claim an item someone else holds unless --steal is given; --steal removes their claim from the selected remote. Claims on other (fork) remotes are reported as collisions.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := cmdUser(cmd, g)
+			if err != nil {
+				return err
+			}
+			opts := options{
+				item:    args[0],
+				remote:  flags.remote,
+				who:     flags.who,
+				steal:   flags.steal,
+				yes:     flags.yes,
+				console: cmdConsole(cmd),
+			}
+			return runClaim(cmd.Context(), g, opts, user, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	addClaimFlags(cmd, &flags, "take over an item claimed by someone else")
+	return cmd
+}
+
+// newUnclaimCmd implements `mob-consensus unclaim ITEM`.
+func newUnclaimCmd(g consensus.Git) *cobra.Command {
+	var flags claimFlags
+	cmd := &cobra.Command{
+		Use:   "unclaim ITEM",
+		Short: "Release a work item by deleting claims/ITEM/<user> on a remote",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := cmdUser(cmd, g)
+			if err != nil {
+				return err
+			}
+			opts := options{
+				item:    args[0],
+				remote:  flags.remote,
+				who:     flags.who,
+				steal:   flags.steal,
+				yes:     flags.yes,
+				console: cmdConsole(cmd),
+			}
+			return runUnclaim(cmd.Context(), g, opts, user, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	addClaimFlags(cmd, &flags, "allow removing a claim made under another --who label")
+	return cmd
+}
+
+// newClaimsCmd implements `mob-consensus claims`.
+func newClaimsCmd(g consensus.Git) *cobra.Command {
+	var remote, item string
+	cmd := &cobra.Command{
+		Use:   "claims",
+		Short: "Fetch and list work-item claims across remotes",
+		Long:  "Fetch claim refs from every remote (or only --remote), list each claim with its claimant, remote, and age, and report items claimed by more than one person.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			opts := options{
+				remote:  remote,
+				item:    item,
+				yes:     true,
+				console: cmdConsole(cmd),
+			}
+			return runClaims(cmd.Context(), g, opts, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	cmd.Flags().StringVar(&remote, "remote", "", "only list claims on this remote")
+	cmd.Flags().StringVar(&item, "item", "", "only list claims of this item")
+	return cmd
+}
+
+// newTeamCmd groups roster helpers under `mob-consensus team ...`.
+func newTeamCmd(g consensus.Git) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "team",
+		Short: "Collaborator roster helpers",
+		Args:  cobra.NoArgs,
+	}
+	cmd.AddCommand(newTeamSyncCmd(g))
+	return cmd
+}
+
+// newTeamSyncCmd implements `mob-consensus team sync`.
+func newTeamSyncCmd(g consensus.Git) *cobra.Command {
+	var flags onboardingFlags
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Add/update git remotes for every collaborator in " + consensus.TeamFile,
+		Long: "Read the repo-tracked " + consensus.TeamFile + " roster and add or update one git remote per collaborator fork (with the default fetch refspec). " +
+			"The entry matching your <user> becomes remote.pushDefault. Remotes that already point at a listed URL are reused.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := validateOnboardingFlags(flags); err != nil {
+				return err
+			}
+			user, err := cmdUser(cmd, g)
+			if err != nil {
+				return err
+			}
+			opts := options{
+				plan:    flags.plan,
+				dryRun:  flags.dryRun,
+				yes:     flags.yes,
+				console: cmdConsole(cmd),
+			}
+			return runTeamSync(cmd.Context(), g, opts, user, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	cmd.Flags().BoolVar(&flags.plan, "plan", false, "print the plan (commands + explanations) and exit")
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "print commands only; no prompts or execution")
+	cmd.Flags().BoolVar(&flags.yes, "yes", false, "accept defaults and run non-interactively")
+	return cmd
+}
+
+// newTUICmd implements `mob-consensus tui`.
+func newTUICmd(g consensus.Git, force, noPush, commitDirty *bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   "tui",
+		Short: "Interactive branch table, merge picker, and onboarding wizard",
+		Long: "Show related branches with ahead/behind/diverged badges (refreshed live), merge the selected branch, and run init/start/join from a step-list wizard.\n\n" +
+			"Merges and onboarding steps run with the TUI suspended, so mergetool, difftool, and editors get the terminal. Requires a terminal; scripts should use the plain commands.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			opts := options{
+				force:       *force,
+				noPush:      *noPush,
+				commitDirty: *commitDirty,
+				console:     cmdConsole(cmd),
+			}
+			user, err := cmdUser(cmd, g)
+			if err != nil {
+				return err
+			}
+			return runTUI(cmd.Context(), g, opts, user, cmd.OutOrStdout())
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ConfigAssistCommand names a local command that drafts merge summaries and
+// commit message bodies (see CommandAssistant). Unset means no assistant.
+const ConfigAssistCommand = "mob-consensus.assistCommand"
+
+// AssistSchemaVersion is the AssistRequest.SchemaVersion this package sends.
+// It is bumped on incompatible changes.
+const AssistSchemaVersion = 1
+
+// MaxAssistDiff caps AssistRequest.Diff; longer diffs are cut and marked
+// DiffTruncated.
+const MaxAssistDiff = 256 << 10
+
+// AssistRequest is the input to an Assistant: the staged merge result and
+// where it came from.
+type AssistRequest struct {
+	SchemaVersion int    `json:"schema_version"`
+	Target        string `json:"target"`
+	CurrentBranch string `json:"current_branch"`
+	// Diff is `git diff --cached HEAD` for the in-progress merge.
+	Diff          string `json:"diff"`
+	DiffTruncated bool   `json:"diff_truncated"`
+	// Conflicts are the paths that conflicted before they were resolved.
+	Conflicts []string `json:"conflicts"`
+	// Commits are the peer commits being merged (HEAD..Target, or every
+	// target's commits for an octopus merge), newest first.
+	Commits []AssistCommit `json:"commits"`
+}
+
+// AssistCommit is one peer commit in an AssistRequest.
+type AssistCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Subject string `json:"subject"`
+}
+
+// AssistResponse is an Assistant's answer. Both fields are suggestions for a
+// human: Summary is shown before the review, and Body is placed in the merge
+// message, which still goes through the editor/approval step.
+type AssistResponse struct {
+	Summary string `json:"summary"`
+	Body    string `json:"body"`
+}
+
+// Assistant drafts a merge summary and commit message body. Implementations
+// may call an LLM; their output is never treated as commands and never
+// committed without review.
+type Assistant interface {
+	Assist(ctx context.Context, req AssistRequest) (AssistResponse, error)
+}
+
+// CommandAssistant is an Assistant backed by a local command: the request is
+// written to the command's stdin as JSON, and the command must print an
+// AssistResponse as JSON on stdout. It runs through `sh -c`, so Command may
+// include arguments.
+type CommandAssistant struct {
+	Command string
+	// Dir is the command's working directory. Empty means the process cwd.
+	Dir string
+}
+
+// Assist implements Assistant.
+func (a CommandAssistant) Assist(ctx context.Context, req AssistRequest) (AssistResponse, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return AssistResponse{}, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", a.Command)
+	cmd.Dir = a.Dir
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return AssistResponse{}, fmt.Errorf("mob-consensus: assistant %q failed: %w: %s", a.Command, err, msg)
+		}
+		return AssistResponse{}, fmt.Errorf("mob-consensus: assistant %q failed: %w", a.Command, err)
+	}
+
+	var resp AssistResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return AssistResponse{}, fmt.Errorf("mob-consensus: assistant %q printed invalid JSON: %w (hint: print {\"summary\": ..., \"body\": ...} on stdout)", a.Command, err)
+	}
+	resp.Summary = strings.TrimSpace(resp.Summary)
+	resp.Body = strings.TrimSpace(resp.Body)
+	if resp.Summary == "" && resp.Body == "" {
+		return AssistResponse{}, fmt.Errorf("mob-consensus: assistant %q returned neither a summary nor a body", a.Command)
+	}
+	return resp, nil
+}
+
+// ConfiguredAssistant returns the CommandAssistant named by
+// ConfigAssistCommand, or nil when none is configured.
+func (r Runner) ConfiguredAssistant(ctx context.Context) Assistant {
+	command, _ := r.outputTrimmed(ctx, "config", "--get", ConfigAssistCommand)
+	if command == "" {
+		return nil
+	}
+	return CommandAssistant{Command: command, Dir: r.git().Dir()}
+}
+
+// AssistRequest collects the staged merge result of plan, the conflicted
+// paths, and the peer commits being merged.
+func (r Runner) AssistRequest(ctx context.Context, plan MergePlan, conflicted []string) (AssistRequest, error) {
+	req := AssistRequest{
+		SchemaVersion: AssistSchemaVersion,
+		Target:        plan.Target,
+		CurrentBranch: plan.CurrentBranch,
+		Conflicts:     append([]string{}, conflicted...),
+		Commits:       []AssistCommit{},
+	}
+	diff, err := r.output(ctx, "diff", "--cached", "--no-color", "--no-ext-diff", "HEAD")
+	if err != nil {
+		return AssistRequest{}, err
+	}
+	if len(diff) > MaxAssistDiff {
+		diff, req.DiffTruncated = diff[:MaxAssistDiff], true
+	}
+	req.Diff = diff
+
+	logArgs := []string{"log", "HEAD.." + plan.Target}
+	if len(plan.Targets) > 1 {
+		logArgs = append([]string{"log", "^HEAD"}, plan.Targets...)
+	}
+	log, err := r.output(ctx, append(logArgs, "--pretty=format:%H%x00%an <%ae>%x00%s")...)
+	if err != nil {
+		return AssistRequest{}, err
+	}
+	for _, line := range splitLines(log) {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		req.Commits = append(req.Commits, AssistCommit{Hash: fields[0], Author: fields[1], Subject: fields[2]})
+	}
+	return req, nil
+}
+
+// DraftMergeMessage inserts a drafted body between the subject and the
+// Co-authored-by trailers of a MergeMessage. An empty body returns msg
+// unchanged.
+func DraftMergeMessage(msg []byte, body string) []byte {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return msg
+	}
+	subject, trailers, _ := strings.Cut(string(msg), "\n\n")
+	out := subject + "\n\n" + body + "\n"
+	if trailers = strings.TrimSpace(trailers); trailers != "" {
+		out += "\n" + trailers + "\n"
+	}
+	return []byte(out)
+}
@@ -0,0 +1,174 @@
+package consensus
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClaimsNamespace is the branch namespace that holds work-item claims. A claim
+// of <item> by <who> is the branch "claims/<item>/<who>" on a remote (the ref
+// refs/heads/claims/<item>/<who>), pointing at a claim commit made when the
+// claim was made or renewed (see ClaimCommit). Keeping claims under refs/heads
+// means a plain `git fetch` makes them visible as
+// refs/remotes/<remote>/claims/...
+//
+// Claims are non-exclusive at the ref level (each claimant owns a separate
+// ref), so collisions can be detected across fork remotes; exclusivity is
+// enforced by the CLI refusing to claim an item someone else holds.
+const ClaimsNamespace = "claims"
+
+// Claim is one claim ref as seen through a remote-tracking ref.
+type Claim struct {
+	Item   string
+	Who    string
+	Remote string
+	// Tip is the commit SHA the claim ref points at.
+	Tip string
+	// Date is the committer date of Tip, i.e. when the claim was made or
+	// last renewed.
+	Date time.Time
+}
+
+// Branch returns the claim's branch name on its remote.
+func (c Claim) Branch() string {
+	return ClaimBranch(c.Item, c.Who)
+}
+
+// ClaimBranch returns the branch name that records a claim of item by who.
+func ClaimBranch(item, who string) string {
+	return ClaimsNamespace + "/" + item + "/" + who
+}
+
+// ClaimRef returns the fully-qualified ref that records a claim of item by who.
+func ClaimRef(item, who string) string {
+	return "refs/heads/" + ClaimBranch(item, who)
+}
+
+// ClaimCommit creates the commit a claim ref points at: a parentless commit of
+// the empty tree with the message "claim <item> by <who>", dated now. It
+// carries none of the claimant's work, and its committer date is the claim's
+// age.
+func (r Runner) ClaimCommit(ctx context.Context, item, who string) (string, error) {
+	tree, err := r.outputTrimmed(ctx, "hash-object", "-w", "-t", "tree", os.DevNull)
+	if err != nil {
+		return "", err
+	}
+	return r.outputTrimmed(ctx, "commit-tree", tree, "-m", "claim "+item+" by "+who)
+}
+
+// ClaimFetchRefspec returns the refspec that mirrors remote's claim refs into
+// refs/remotes/<remote>/claims/. Fetching with --prune and this refspec only
+// prunes claim refs, so dropped claims disappear without touching other
+// remote-tracking branches.
+func ClaimFetchRefspec(remote string) string {
+	return "+refs/heads/" + ClaimsNamespace + "/*:refs/remotes/" + remote + "/" + ClaimsNamespace + "/*"
+}
+
+// ParseClaimRef parses a remote-tracking claim ref of the form
+// "refs/remotes/<remote>/claims/<item>/<who>". Items may contain slashes; the
+// claimant is always the final path element. ok is false for other refs.
+func ParseClaimRef(ref string, remotes []string) (c Claim, ok bool) {
+	rest, found := strings.CutPrefix(ref, "refs/remotes/")
+	if !found {
+		return Claim{}, false
+	}
+	// Prefer the longest matching remote name so remotes that contain '/'
+	// are split correctly.
+	remote := ""
+	for _, r := range remotes {
+		if strings.HasPrefix(rest, r+"/") && len(r) > len(remote) {
+			remote = r
+		}
+	}
+	if remote == "" {
+		return Claim{}, false
+	}
+	rest, found = strings.CutPrefix(strings.TrimPrefix(rest, remote+"/"), ClaimsNamespace+"/")
+	if !found {
+		return Claim{}, false
+	}
+	i := strings.LastIndexByte(rest, '/')
+	if i <= 0 || i == len(rest)-1 {
+		return Claim{}, false
+	}
+	return Claim{Item: rest[:i], Who: rest[i+1:], Remote: remote}, true
+}
+
+// Claims lists claim refs from the remote-tracking refs of the given remotes
+// (all configured remotes when none are given), sorted by item, claimant,
+// and remote. Callers should fetch first; see ClaimFetchRefspec.
+func (r Runner) Claims(ctx context.Context, remotes ...string) ([]Claim, error) {
+	if len(remotes) == 0 {
+		var err error
+		remotes, err = r.Remotes(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(remotes) == 0 {
+		return nil, nil
+	}
+
+	var patterns []string
+	for _, remote := range remotes {
+		patterns = append(patterns, "refs/remotes/"+remote+"/"+ClaimsNamespace+"/")
+	}
+	args := append([]string{"for-each-ref", "--format=%(refname) %(objectname) %(committerdate:unix)"}, patterns...)
+	out, err := r.output(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims []Claim
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		c, ok := ParseClaimRef(fields[0], remotes)
+		if !ok {
+			continue
+		}
+		c.Tip = fields[1]
+		if sec, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			c.Date = time.Unix(sec, 0)
+		}
+		claims = append(claims, c)
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		a, b := claims[i], claims[j]
+		if a.Item != b.Item {
+			return a.Item < b.Item
+		}
+		if a.Who != b.Who {
+			return a.Who < b.Who
+		}
+		return a.Remote < b.Remote
+	})
+	return claims, nil
+}
+
+// ClaimCollisions groups claims by item and returns the items claimed by more
+// than one claimant. The same claimant holding an item on several remotes (ex:
+// their fork and a coordination remote) is not a collision.
+func ClaimCollisions(claims []Claim) map[string][]Claim {
+	byItem := map[string][]Claim{}
+	for _, c := range claims {
+		byItem[c.Item] = append(byItem[c.Item], c)
+	}
+	out := map[string][]Claim{}
+	for item, cs := range byItem {
+		who := map[string]bool{}
+		for _, c := range cs {
+			who[c.Who] = true
+		}
+		if len(who) > 1 {
+			out[item] = cs
+		}
+	}
+	return out
+}
@@ -0,0 +1,261 @@
+// Package consensus is the non-interactive engine behind mob-consensus.
+//
+// It derives twigs and the "<user>" branch prefix, discovers related
+// "<user>/<twig>" branches and how they compare to the current branch, resolves
+// merge targets, and builds merge commit messages with Co-authored-by trailers.
+//
+// The package never prompts and never writes to stdin/stdout. Every result is
+// returned as structured data; callers (the mob-consensus CLI, Storm, tests)
+// render it and own the interactive steps such as mergetool, difftool,
+// `git commit -e`, and confirmations.
+package consensus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Runner runs the engine's read-only git queries against one repository.
+type Runner struct {
+	// Git is the backend used for every query. Nil means ExecGit in the
+	// process cwd.
+	Git Git
+}
+
+// Twig extracts the twig from a branch name using DefaultBranchTemplate (see
+// Naming.Twig).
+// Examples:
+//   - "alice/feature-x" => "feature-x"
+//   - "feature-x"       => "feature-x"
+func Twig(branch string) string {
+	return DefaultNaming().Twig(branch)
+}
+
+// RelatedBranches filters the output of `git branch -a` to the branches of
+// twig under DefaultBranchTemplate (see Naming.Related). It ignores the
+// current-branch marker "*" and symbolic-ref lines like
+// "remotes/origin/HEAD -> origin/main".
+func RelatedBranches(branchAOutput, twig string) []string {
+	n := DefaultNaming()
+	var out []string
+	for _, line := range strings.Split(branchAOutput, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "->") {
+			continue
+		}
+		if !n.Related(line, twig) {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// SplitBranch splits a related branch name as listed by `git branch -a` into
+// its remote (empty for local branches) and the "<user>" in it, using
+// DefaultBranchTemplate (see Naming.SplitBranch). Examples (twig
+// "feature-x"):
+//   - "alice/feature-x"                => "", "alice"
+//   - "remotes/origin/alice/feature-x" => "origin", "alice"
+func SplitBranch(branch, twig string) (remote, user string) {
+	return DefaultNaming().SplitBranch(branch, twig)
+}
+
+// UserFromEmail returns the part of email left of '@', trimmed. It does not
+// validate the result; see Runner.User.
+func UserFromEmail(email string) string {
+	user := strings.TrimSpace(email)
+	if at := strings.IndexByte(user, '@'); at >= 0 {
+		user = user[:at]
+	}
+	return strings.TrimSpace(user)
+}
+
+// ValidUser reports whether user can be used as a "<user>/" branch prefix.
+// Users may not contain '/' (see Naming).
+func (r Runner) ValidUser(ctx context.Context, user string) bool {
+	if user == "" || strings.Contains(user, "/") {
+		return false
+	}
+	_, err := r.output(ctx, "check-ref-format", "--branch", user+"/probe")
+	return err == nil
+}
+
+// ConfigUser is the git config key that sets the "<user>" label directly,
+// overriding user.email and the TeamFile label map.
+const ConfigUser = "mob-consensus.user"
+
+// TeamFileWarning is returned by UserLabel and User together with a usable
+// label when TeamFile couldn't be loaded; the label then comes from
+// user.email. Callers should report it and carry on.
+type TeamFileWarning struct {
+	Err error
+}
+
+func (w TeamFileWarning) Error() string {
+	return fmt.Sprintf("mob-consensus: ignoring %s for the <user> label: %v", TeamFile, w.Err)
+}
+
+func (w TeamFileWarning) Unwrap() error {
+	return w.Err
+}
+
+// UserLabel returns the unvalidated "<user>" label and where it came from,
+// checking in order:
+//   - `git config mob-consensus.user` (source ConfigUser)
+//   - the label TeamFile's [labels] table maps user.email to (source TeamFile)
+//   - the part of user.email left of '@' (source "user.email")
+//
+// A TeamFile that can't be loaded is skipped; the label is returned with a
+// TeamFileWarning.
+func (r Runner) UserLabel(ctx context.Context) (user, source string, err error) {
+	if user, _ := r.outputTrimmed(ctx, "config", "--get", ConfigUser); user != "" {
+		return user, ConfigUser, nil
+	}
+	email, err := r.outputTrimmed(ctx, "config", "--get", "user.email")
+	if err != nil || email == "" {
+		return "", "", errors.New("mob-consensus: git user.email is not set (hint: git config --local user.email alice@example.com)")
+	}
+	team, _, err := r.LoadTeam(ctx)
+	if err != nil {
+		return UserFromEmail(email), "user.email", TeamFileWarning{Err: err}
+	}
+	if label, ok := team.label(email); ok {
+		return label, TeamFile, nil
+	}
+	return UserFromEmail(email), "user.email", nil
+}
+
+// User returns the "<user>" branch prefix (see UserLabel) and validates that
+// it can be used in a branch name. Like UserLabel, it returns a usable prefix
+// together with a TeamFileWarning when TeamFile couldn't be loaded.
+func (r Runner) User(ctx context.Context) (string, error) {
+	user, source, err := r.UserLabel(ctx)
+	var warning TeamFileWarning
+	if err != nil && !errors.As(err, &warning) {
+		return "", err
+	}
+	if source != "user.email" {
+		if !r.ValidUser(ctx, user) {
+			return "", fmt.Errorf("mob-consensus: <user> %q (from %s) produces an invalid branch name (hint: pick a label without spaces or '/')", user, source)
+		}
+		return user, nil
+	}
+
+	email, _ := r.outputTrimmed(ctx, "config", "--get", "user.email")
+	if user == "" {
+		return "", fmt.Errorf("mob-consensus: could not derive a username from git user.email=%q (hint: git config --local %s alice)", email, ConfigUser)
+	}
+	if !r.ValidUser(ctx, user) {
+		return "", fmt.Errorf("mob-consensus: derived username %q (from git user.email=%q) produces an invalid branch name (hint: git config --local %s alice)", user, email, ConfigUser)
+	}
+	return user, err
+}
+
+// CurrentBranch returns the abbreviated name of HEAD ("HEAD" when detached).
+func (r Runner) CurrentBranch(ctx context.Context) (string, error) {
+	return r.outputTrimmed(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+// Remotes returns configured remote names (as shown by `git remote`).
+func (r Runner) Remotes(ctx context.Context) ([]string, error) {
+	remotesOut, err := r.outputTrimmed(ctx, "remote")
+	if err != nil {
+		return nil, err
+	}
+	if remotesOut == "" {
+		return nil, nil
+	}
+
+	var remotes []string
+	for _, line := range strings.Split(remotesOut, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		remotes = append(remotes, line)
+	}
+	return remotes, nil
+}
+
+// upstreamRemote returns the remote of the current branch's upstream when it
+// is one of remotes, or "".
+func (r Runner) upstreamRemote(ctx context.Context, remotes []string) string {
+	upstream, err := r.outputTrimmed(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	if err != nil || upstream == "" {
+		return ""
+	}
+	i := strings.IndexByte(upstream, '/')
+	if i <= 0 {
+		return ""
+	}
+	for _, remote := range remotes {
+		if remote == upstream[:i] {
+			return remote
+		}
+	}
+	return ""
+}
+
+// SuggestedRemote returns a default remote name when the choice is
+// unambiguous, plus the full remote list and a short explanation of the
+// selection.
+//
+// Policy: never assume `origin`. We only select a remote automatically when:
+//   - the current branch has an upstream remote, or
+//   - there is exactly one configured remote.
+func (r Runner) SuggestedRemote(ctx context.Context) (string, []string, string) {
+	remotes, err := r.Remotes(ctx)
+	if err != nil || len(remotes) == 0 {
+		return "", nil, ""
+	}
+	if remote := r.upstreamRemote(ctx, remotes); remote != "" {
+		return remote, remotes, "from current branch upstream"
+	}
+	if len(remotes) == 1 {
+		return remotes[0], remotes, "only configured remote"
+	}
+	return "", remotes, ""
+}
+
+// FetchRemote selects the remote `status`/`merge` should fetch, using the same
+// policy as SuggestedRemote (upstream remote or only remote), with one extra
+// heuristic: if otherBranch is prefixed with a remote name (ex:
+// "jj/alice/feature-x"), that remote is selected.
+func (r Runner) FetchRemote(ctx context.Context, otherBranch string) (string, error) {
+	remotes, err := r.Remotes(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(remotes) == 0 {
+		return "", errors.New("mob-consensus: no remotes configured (hint: git remote -v)")
+	}
+
+	if i := strings.IndexByte(otherBranch, '/'); i > 0 {
+		for _, remote := range remotes {
+			if remote == otherBranch[:i] {
+				return remote, nil
+			}
+		}
+	}
+	if remote := r.upstreamRemote(ctx, remotes); remote != "" {
+		return remote, nil
+	}
+	if len(remotes) == 1 {
+		return remotes[0], nil
+	}
+	return "", fmt.Errorf("mob-consensus: multiple remotes configured (%s); set an upstream or fetch explicitly (e.g., git fetch <remote>)", strings.Join(remotes, ", "))
+}
+
+// sortedCopy returns a sorted copy of in.
+func sortedCopy(in []string) []string {
+	out := append([]string(nil), in...)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,274 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State summarizes how a related branch compares to the current branch.
+type State string
+
+const (
+	// StateSynced means neither side has changes the other lacks.
+	StateSynced State = "synced"
+	// StateAhead means the related branch has changes the current branch lacks.
+	StateAhead State = "ahead"
+	// StateBehind means the current branch has changes the related branch lacks.
+	StateBehind State = "behind"
+	// StateDiverged means both sides have changes the other lacks.
+	StateDiverged State = "diverged"
+)
+
+// BranchStatus compares one related branch to the current branch.
+//
+// Ahead and Behind hold `git diff --shortstat` output for the symmetric
+// differences "...<branch>" and "<branch>..." respectively; an empty string
+// means there is nothing on that side. The state is derived from these diffs
+// (not from commit counts), so a branch whose extra commits cancel out is
+// still reported as synced.
+type BranchStatus struct {
+	// Branch is the name as listed by `git branch -a` (ex: "bob/twig" or
+	// "remotes/origin/bob/twig").
+	Branch string
+	// Remote is the remote name for remote-tracking branches, else "".
+	Remote string
+	// User is the "<user>" prefix in front of "/<twig>".
+	User string
+	// Tip is the commit SHA the branch points at. TipAuthor, TipTime, and
+	// TipSubject describe that commit: its author name, committer date (the
+	// branch's last activity), and subject line.
+	Tip        string
+	TipAuthor  string
+	TipTime    time.Time
+	TipSubject string
+
+	Ahead  string
+	Behind string
+
+	// AheadCommits counts commits on the branch that HEAD lacks;
+	// BehindCommits counts commits on HEAD that the branch lacks.
+	AheadCommits  int
+	BehindCommits int
+
+	// Merge is the outcome of a trial merge into HEAD, for diverged
+	// branches only. It is nil when not predicted (not diverged, or git is
+	// older than 2.38 and lacks `merge-tree --write-tree`).
+	Merge *MergePrediction
+}
+
+// MergePrediction is the result of PredictMerge.
+type MergePrediction struct {
+	// Conflicts lists the paths that would conflict; empty means the merge
+	// would be clean.
+	Conflicts []string
+}
+
+// Clean reports whether the merge would apply without conflicts.
+func (p MergePrediction) Clean() bool {
+	return len(p.Conflicts) == 0
+}
+
+// State derives the ahead/behind/diverged/synced state from the shortstats.
+func (s BranchStatus) State() State {
+	switch {
+	case s.Ahead != "" && s.Behind != "":
+		return StateDiverged
+	case s.Ahead != "":
+		return StateAhead
+	case s.Behind != "":
+		return StateBehind
+	default:
+		return StateSynced
+	}
+}
+
+// Idle reports how long before now the branch last changed (its tip's
+// committer date).
+func (s BranchStatus) Idle(now time.Time) time.Duration {
+	return now.Sub(s.TipTime)
+}
+
+// Discovery is the result of comparing the current branch with every related
+// branch of its twig.
+type Discovery struct {
+	CurrentBranch string
+	Twig          string
+	// Head is the commit SHA of the current branch.
+	Head string
+	// Branches lists related branches (excluding the current branch) in
+	// `git branch -a` order.
+	Branches []BranchStatus
+	// Naming is the branch naming the twig and users were parsed with.
+	Naming Naming
+}
+
+// Discover lists the branches related to the twig of currentBranch (see
+// Runner.Twig and Naming.Related) and compares each of them to the current branch.
+//
+// Refs, tips, and (on git 2.41+) ahead/behind counts come from a single
+// `git for-each-ref`. The per-branch work (shortstats, trial merges, and
+// counts on older git) runs once per distinct tip, so local and
+// remote-tracking copies of a branch share it, on a bounded pool of
+// goroutines that stops when ctx is cancelled. Branches keeps `git branch
+// -a` order regardless.
+func (r Runner) Discover(ctx context.Context, currentBranch string) (Discovery, error) {
+	d := Discovery{CurrentBranch: currentBranch}
+	n, err := r.Naming(ctx)
+	if err != nil {
+		return d, err
+	}
+	d.Naming = n
+
+	head, err := r.outputTrimmed(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return d, err
+	}
+	d.Head = head
+
+	all, counted, err := r.branchRefs(ctx, true)
+	if err != nil {
+		return d, err
+	}
+	d.Twig = n.twigAmong(currentBranch, all)
+	refs := relatedIn(n, d.Twig, all)
+
+	var tips []string
+	byTip := map[string]*BranchStatus{}
+	for _, ref := range refs {
+		if ref.Branch == currentBranch {
+			continue
+		}
+		if _, ok := byTip[ref.Tip]; !ok {
+			tips = append(tips, ref.Tip)
+			byTip[ref.Tip] = &BranchStatus{
+				Tip:           ref.Tip,
+				TipAuthor:     ref.Author,
+				TipTime:       ref.Time,
+				TipSubject:    ref.Subject,
+				AheadCommits:  ref.AheadCommits,
+				BehindCommits: ref.BehindCommits,
+			}
+		}
+	}
+
+	err = parallel(ctx, len(tips), runtime.GOMAXPROCS(0), func(ctx context.Context, i int) error {
+		s := byTip[tips[i]]
+		var err error
+		if !counted {
+			if s.BehindCommits, s.AheadCommits, err = r.leftRightCount(ctx, "HEAD", s.Tip); err != nil {
+				return err
+			}
+		}
+		if s.Ahead, err = r.outputTrimmed(ctx, "diff", "--shortstat", "..."+s.Tip); err != nil {
+			return err
+		}
+		if s.Behind, err = r.outputTrimmed(ctx, "diff", "--shortstat", s.Tip+"..."); err != nil {
+			return err
+		}
+		if s.State() == StateDiverged {
+			if p, err := r.PredictMerge(ctx, s.Tip); err == nil {
+				s.Merge = &p
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return d, err
+	}
+
+	for _, ref := range refs {
+		if ref.Branch == currentBranch {
+			continue
+		}
+		s := *byTip[ref.Tip]
+		s.Branch = ref.Branch
+		s.Remote, s.User = n.SplitBranch(ref.Branch, d.Twig)
+		d.Branches = append(d.Branches, s)
+	}
+	return d, nil
+}
+
+// PredictMerge runs a trial merge of branch into HEAD in memory (`git
+// merge-tree --write-tree`), without touching the index or worktree, and
+// reports the paths that would conflict.
+func (r Runner) PredictMerge(ctx context.Context, branch string) (MergePrediction, error) {
+	return r.PredictMergeInto(ctx, "HEAD", branch)
+}
+
+// PredictMergeInto is PredictMerge for a merge of branch into the commit
+// into (ex: the base branch a twig lands on).
+func (r Runner) PredictMergeInto(ctx context.Context, into, branch string) (MergePrediction, error) {
+	out, err := r.output(ctx, "merge-tree", "--write-tree", "--name-only", "--no-messages", into, branch)
+	if err != nil {
+		// Exit status 1 means the merge has conflicts; the output is the
+		// tree followed by the conflicted paths.
+		var exit interface{ ExitCode() int }
+		if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+			return MergePrediction{}, err
+		}
+	}
+	lines := splitLines(out)
+	if len(lines) == 0 {
+		return MergePrediction{}, fmt.Errorf("mob-consensus: unexpected empty git merge-tree output for %s", branch)
+	}
+	return MergePrediction{Conflicts: lines[1:]}, nil
+}
+
+// leftRightCount returns the number of commits reachable only from left and
+// only from right (`git rev-list --left-right --count left...right`).
+func (r Runner) leftRightCount(ctx context.Context, left, right string) (int, int, error) {
+	out, err := r.outputTrimmed(ctx, "rev-list", "--left-right", "--count", left+"..."+right)
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("mob-consensus: unexpected rev-list --count output %q", out)
+	}
+	l, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	rc, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return l, rc, nil
+}
+
+// ShortStat holds the numbers from one line of `git diff --shortstat`.
+type ShortStat struct {
+	Files      int
+	Insertions int
+	Deletions  int
+}
+
+var (
+	shortStatFiles      = regexp.MustCompile(`(\d+) files? changed`)
+	shortStatInsertions = regexp.MustCompile(`(\d+) insertions?\(\+\)`)
+	shortStatDeletions  = regexp.MustCompile(`(\d+) deletions?\(-\)`)
+)
+
+// ParseShortStat extracts the counts from `git diff --shortstat` output such
+// as "2 files changed, 3 insertions(+), 1 deletion(-)". Missing parts are 0.
+func ParseShortStat(s string) ShortStat {
+	find := func(re *regexp.Regexp) int {
+		m := re.FindStringSubmatch(s)
+		if m == nil {
+			return 0
+		}
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return ShortStat{
+		Files:      find(shortStatFiles),
+		Insertions: find(shortStatInsertions),
+		Deletions:  find(shortStatDeletions),
+	}
+}
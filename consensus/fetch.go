@@ -0,0 +1,129 @@
+package consensus
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigAllowOffline, when true, lets status/merge/sync continue with the
+// local remote-tracking refs when fetching fails (no network, a fork host
+// is down) instead of stopping.
+const ConfigAllowOffline = "mob-consensus.allowOffline"
+
+// AllowOffline reports whether ConfigAllowOffline is set.
+func (r Runner) AllowOffline(ctx context.Context) bool {
+	v, _ := r.outputTrimmed(ctx, "config", "--bool", "--get", ConfigAllowOffline)
+	return v == "true"
+}
+
+// LastFetch estimates when each of remotes was last fetched: the newest of
+// FETCH_HEAD's modification time (for the remote it names; git rewrites it
+// on every fetch) and the newest reflog entry of the remote's
+// remote-tracking refs (updated whenever a fetch moves one). Remotes with
+// neither are left out of the result.
+func (r Runner) LastFetch(ctx context.Context, remotes []string) (map[string]time.Time, error) {
+	last := map[string]time.Time{}
+	note := func(remote string, t time.Time) {
+		if t.After(last[remote]) {
+			last[remote] = t
+		}
+	}
+
+	for _, remote := range remotes {
+		dir, err := r.GitPath(ctx, "logs/refs/remotes/"+remote)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return err
+			}
+			if t, ok := lastReflogTime(path); ok {
+				note(remote, t)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	path, err := r.GitPath(ctx, "FETCH_HEAD")
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return last, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	urls := map[string]string{}
+	for _, remote := range remotes {
+		if url, _ := r.outputTrimmed(ctx, "config", "--get", "remote."+remote+".url"); url != "" {
+			urls[normalizeFetchURL(url)] = remote
+		}
+	}
+	for _, line := range splitLines(string(data)) {
+		// "<sha>\t[not-for-merge]\t[branch 'x' of ]<url>"
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		url := fields[2]
+		if i := strings.LastIndex(url, " of "); i >= 0 {
+			url = url[i+len(" of "):]
+		}
+		if remote, ok := urls[normalizeFetchURL(url)]; ok {
+			note(remote, info.ModTime())
+		}
+	}
+	return last, nil
+}
+
+// normalizeFetchURL strips what git drops from a remote URL when writing
+// FETCH_HEAD: trailing slashes and a ".git" suffix.
+func normalizeFetchURL(url string) string {
+	url = strings.TrimRight(url, "/")
+	url = strings.TrimSuffix(url, ".git")
+	return strings.TrimRight(url, "/")
+}
+
+// lastReflogTime returns the timestamp of the last entry of a reflog file
+// ("<old> <new> <ident> <unix> <tz>\t<message>").
+func lastReflogTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	var last string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if sc.Text() != "" {
+			last = sc.Text()
+		}
+	}
+	head, _, _ := strings.Cut(last, "\t")
+	fields := strings.Fields(head)
+	if len(fields) < 2 {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
@@ -0,0 +1,151 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Git runs git subcommands against one repository.
+//
+// The CLI uses ExecGit; tests and embedders can supply a scripted fake. All
+// engine and CLI git access goes through this interface, so nothing depends
+// on the process working directory or the process stdio.
+type Git interface {
+	// Dir returns the directory git runs in. Empty means the process cwd.
+	Dir() string
+	// Output runs `git <args...>` and returns stdout. Errors include the
+	// command line and stderr, and wrap an error with an ExitCode() int
+	// method when git ran and failed. Stdout is returned even then: some
+	// commands (ex: `git merge-tree`) report results through the exit code.
+	Output(ctx context.Context, args ...string) (string, error)
+	// Run runs `git <args...>` connected to the backend's stdio. It's used for
+	// interactive commands like commit/mergetool/difftool.
+	Run(ctx context.Context, args ...string) error
+}
+
+// ExecGit is the real Git backend. It executes the `git` binary in RepoDir.
+type ExecGit struct {
+	// RepoDir is the repository working directory. Empty means the process
+	// cwd.
+	RepoDir string
+	// Env holds extra "KEY=value" entries appended to the process
+	// environment.
+	Env []string
+	// Stdin, Stdout and Stderr are connected to commands started by Run. A nil
+	// stream is connected to the null device, as with os/exec.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Dir implements Git.
+func (g ExecGit) Dir() string {
+	return g.RepoDir
+}
+
+// Output implements Git.
+func (g ExecGit) Output(ctx context.Context, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := g.command(ctx, args)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return string(out), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, msg)
+		}
+		return string(out), fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+// Run implements Git.
+func (g ExecGit) Run(ctx context.Context, args ...string) error {
+	cmd := g.command(ctx, args)
+	cmd.Stdin = g.Stdin
+	cmd.Stdout = g.Stdout
+	cmd.Stderr = g.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// command builds the exec.Cmd shared by Output and Run.
+func (g ExecGit) command(ctx context.Context, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.RepoDir
+	if len(g.Env) > 0 {
+		cmd.Env = append(os.Environ(), g.Env...)
+	}
+	return cmd
+}
+
+// git returns r.Git, defaulting to ExecGit in the process cwd so the zero
+// Runner stays usable.
+func (r Runner) git() Git {
+	if r.Git == nil {
+		return ExecGit{}
+	}
+	return r.Git
+}
+
+// outputTrimmed is output with surrounding whitespace trimmed.
+func (r Runner) outputTrimmed(ctx context.Context, args ...string) (string, error) {
+	out, err := r.output(ctx, args...)
+	return strings.TrimSpace(out), err
+}
+
+// output runs `git <args...>` through r.Git and returns stdout.
+func (r Runner) output(ctx context.Context, args ...string) (string, error) {
+	return r.git().Output(ctx, args...)
+}
+
+// GitDir returns the absolute path of the repository's git directory.
+func (r Runner) GitDir(ctx context.Context) (string, error) {
+	p, err := r.outputTrimmed(ctx, "rev-parse", "--git-dir")
+	if err != nil {
+		return "", err
+	}
+	return r.absPath(p)
+}
+
+// GitPath returns the absolute path of `git rev-parse --git-path name` (ex:
+// "MERGE_HEAD", "MERGE_MSG").
+func (r Runner) GitPath(ctx context.Context, name string) (string, error) {
+	p, err := r.outputTrimmed(ctx, "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	return r.absPath(p)
+}
+
+// IsAncestor reports whether commit a is an ancestor of (or equal to)
+// commit b (`git merge-base --is-ancestor`, which answers through its exit
+// status).
+func (r Runner) IsAncestor(ctx context.Context, a, b string) (bool, error) {
+	_, err := r.output(ctx, "merge-base", "--is-ancestor", a, b)
+	if err == nil {
+		return true, nil
+	}
+	var exit interface{ ExitCode() int }
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, err
+}
+
+// absPath resolves a path printed by git relative to the backend's directory.
+func (r Runner) absPath(p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(r.git().Dir(), p)
+	}
+	return filepath.Abs(p)
+}
@@ -0,0 +1,191 @@
+package consensus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// JournalSchemaVersion is the MergeJournal.SchemaVersion this package writes.
+// Journals with another version are refused rather than guessed at.
+const JournalSchemaVersion = 1
+
+// MergeStep names a completed step of a journaled merge, in order.
+type MergeStep string
+
+const (
+	// MergeStepMerged: `git merge --no-commit` ran and MERGE_HEAD exists.
+	MergeStepMerged MergeStep = "merged"
+	// MergeStepResolved: no unmerged paths remain (mergetool finished).
+	MergeStepResolved MergeStep = "resolved"
+	// MergeStepDrafted: the assistant (if any) drafted the message and
+	// MERGE_MSG was written.
+	MergeStepDrafted MergeStep = "drafted"
+	// MergeStepReviewed: difftool or the built-in review finished.
+	MergeStepReviewed MergeStep = "reviewed"
+	// MergeStepCommitted: the merge commit exists; only the push is left.
+	MergeStepCommitted MergeStep = "committed"
+)
+
+// MergeJournal records an in-progress `mob-consensus merge` under
+// .git/mob-consensus/, so an interrupted merge (failed mergetool, Ctrl-C)
+// can be resumed with `merge --continue` or undone with `merge --abort`.
+type MergeJournal struct {
+	SchemaVersion int `json:"schema_version"`
+	// Requested, Target, and Targets are copied from the MergePlan;
+	// TargetCommits are the commits Targets resolved to.
+	Requested     string   `json:"requested"`
+	Target        string   `json:"target"`
+	Targets       []string `json:"targets"`
+	TargetCommits []string `json:"target_commits"`
+	CurrentBranch string   `json:"current_branch"`
+	// OrigHead is HEAD before the merge started.
+	OrigHead string `json:"orig_head"`
+	// Message is the prepared merge message (with Co-authored-by
+	// trailers, and the assistant's draft once drafted).
+	Message string `json:"message"`
+	// Conflicts are the paths that conflicted, captured before mergetool.
+	Conflicts []string `json:"conflicts"`
+	// Steps are the completed steps, in order.
+	Steps []MergeStep `json:"steps"`
+
+	// The merge's flags, reused by --continue.
+	MergeTool  string `json:"mergetool,omitempty"`
+	DiffTool   string `json:"difftool,omitempty"`
+	NoDiffTool bool   `json:"no_difftool,omitempty"`
+	Review     bool   `json:"review,omitempty"`
+	NoAssist   bool   `json:"no_assist,omitempty"`
+	NoPush     bool   `json:"no_push,omitempty"`
+}
+
+// Done reports whether step has completed.
+func (j *MergeJournal) Done(step MergeStep) bool {
+	return slices.Contains(j.Steps, step)
+}
+
+// Mark records step as completed.
+func (j *MergeJournal) Mark(step MergeStep) {
+	if !j.Done(step) {
+		j.Steps = append(j.Steps, step)
+	}
+}
+
+// ErrNoMergeJournal is returned by LoadMergeJournal when no mob-consensus
+// merge is in progress.
+var ErrNoMergeJournal = errors.New("mob-consensus: no mob-consensus merge in progress (hint: start one with `mob-consensus merge OTHER_BRANCH`)")
+
+// JournalDir returns .git/mob-consensus, where in-progress state is kept.
+func (r Runner) JournalDir(ctx context.Context) (string, error) {
+	gitDir, err := r.GitDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, "mob-consensus"), nil
+}
+
+// MergeMessagePath returns the file the journaled merge message is kept in
+// (passed to `git commit -F`).
+func (r Runner) MergeMessagePath(ctx context.Context) (string, error) {
+	dir, err := r.JournalDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "merge.msg"), nil
+}
+
+// journalPath returns .git/mob-consensus/merge.json.
+func (r Runner) journalPath(ctx context.Context) (string, error) {
+	dir, err := r.JournalDir(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "merge.json"), nil
+}
+
+// LoadMergeJournal reads the merge journal. It returns ErrNoMergeJournal when
+// there is none.
+func (r Runner) LoadMergeJournal(ctx context.Context) (*MergeJournal, error) {
+	path, err := r.journalPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoMergeJournal
+	}
+	if err != nil {
+		return nil, err
+	}
+	var j MergeJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("mob-consensus: corrupt merge journal %s: %w (hint: inspect it, then remove it and finish with plain git)", path, err)
+	}
+	if j.SchemaVersion != JournalSchemaVersion {
+		return nil, fmt.Errorf("mob-consensus: merge journal %s has schema_version %d, want %d (hint: finish the merge with the mob-consensus version that started it)", path, j.SchemaVersion, JournalSchemaVersion)
+	}
+	return &j, nil
+}
+
+// SaveMergeJournal writes the journal and its message file. Both are written
+// to a temp file and renamed, so a crash never leaves a half-written journal.
+func (r Runner) SaveMergeJournal(ctx context.Context, j *MergeJournal) error {
+	j.SchemaVersion = JournalSchemaVersion
+	dir, err := r.JournalDir(ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "merge.msg"), []byte(j.Message)); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "merge.json"), append(data, '\n'))
+}
+
+// RemoveMergeJournal deletes the journal and its message file. A missing
+// journal is not an error.
+func (r Runner) RemoveMergeJournal(ctx context.Context) error {
+	dir, err := r.JournalDir(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"merge.json", "merge.msg"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data via a temp file in the same
+// directory.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package consensus
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// LabelClash is a "<user>" label that more than one person works under, so
+// their personal branches share names (ex: dev@a.com and dev@b.com both
+// derive "dev").
+type LabelClash struct {
+	User string
+	// Emails are the distinct (lowercased) emails behind User, sorted.
+	Emails []string
+}
+
+// LabelClashes looks for "<user>" labels in d that belong to more than one
+// person. Each personal branch is taken to belong to the committer of its
+// tip, who counts under the branch's label only when their email resolves
+// to it (see Team.Label); a peer who merely committed on someone else's
+// branch is not a clash. email and user are the current identity, which
+// always counts under its own label. Clashes are sorted by label.
+//
+// A peer's mob-consensus.user override lives in their own git config, so it
+// can't be seen here: a peer who picked a label by override only counts when
+// their email happens to resolve to it too. A clash caused by an override is
+// therefore not reported.
+func (r Runner) LabelClashes(ctx context.Context, d Discovery, email, user string) ([]LabelClash, error) {
+	// A roster that can't be loaded maps no emails; User already warns
+	// about it.
+	team, _, _ := r.LoadTeam(ctx)
+
+	// One commit can be the tip of several branches (ex: a local branch
+	// and its remote-tracking copy), so tips map to every label they carry.
+	labels := map[string][]string{}
+	var tips []string
+	for _, b := range d.Branches {
+		// Copies of the shared twig aren't anyone's personal branch.
+		if remote, name := splitRemote(b.Branch); (remote != "" && name == d.Twig) || b.Tip == "" {
+			continue
+		}
+		if _, seen := labels[b.Tip]; !seen {
+			tips = append(tips, b.Tip)
+		}
+		labels[b.Tip] = append(labels[b.Tip], b.User)
+	}
+
+	emails := map[string]map[string]bool{}
+	add := func(user, email string) {
+		if emails[user] == nil {
+			emails[user] = map[string]bool{}
+		}
+		emails[user][strings.ToLower(strings.TrimSpace(email))] = true
+	}
+	if email != "" && user != "" {
+		add(user, email)
+	}
+	if len(tips) > 0 {
+		out, err := r.outputTrimmed(ctx, append([]string{"log", "--no-walk=unsorted", "--format=%H%x09%ce"}, tips...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(out, "\n") {
+			tip, committer, ok := strings.Cut(line, "\t")
+			if !ok {
+				continue
+			}
+			for _, label := range labels[tip] {
+				if team.Label(committer) == label {
+					add(label, committer)
+				}
+			}
+		}
+	}
+
+	var clashes []LabelClash
+	for label, set := range emails {
+		if len(set) < 2 {
+			continue
+		}
+		c := LabelClash{User: label}
+		for e := range set {
+			c.Emails = append(c.Emails, e)
+		}
+		sort.Strings(c.Emails)
+		clashes = append(clashes, c)
+	}
+	sort.Slice(clashes, func(i, j int) bool { return clashes[i].User < clashes[j].User })
+	return clashes, nil
+}
@@ -0,0 +1,111 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Matrix compares every pair of branches of a twig: the current branch and
+// each related branch.
+type Matrix struct {
+	CurrentBranch string
+	Twig          string
+	// Branches lists the current branch first, then the related branches in
+	// `git branch -a` order; Tips holds their commit SHAs.
+	Branches []string
+	Tips     []string
+	// Ahead[i][j] counts the commits on Branches[i] that Branches[j] lacks.
+	Ahead [][]int
+	// Consensus is true when every branch has the same tree: the tips are
+	// identical, or the branches have merged each other's changes.
+	Consensus bool
+}
+
+// Matrix computes the pairwise ahead/behind counts between all branches of
+// the twig of currentBranch. Refs, tips, and trees come from one `git
+// for-each-ref`; each distinct pair of tips then costs one `git rev-list
+// --count`, run on a bounded pool of goroutines, and copies of a branch
+// (local and remote-tracking) share the result.
+func (r Runner) Matrix(ctx context.Context, currentBranch string) (Matrix, error) {
+	m := Matrix{CurrentBranch: currentBranch}
+	n, err := r.Naming(ctx)
+	if err != nil {
+		return m, err
+	}
+	all, _, err := r.branchRefs(ctx, false)
+	if err != nil {
+		return m, err
+	}
+	m.Twig = n.twigAmong(currentBranch, all)
+	refs := relatedIn(n, m.Twig, all)
+	// The current branch comes first; a detached or unrelated HEAD is
+	// compared by its commit.
+	cur := relatedRef{Branch: currentBranch}
+	var others []relatedRef
+	for _, ref := range refs {
+		if ref.Branch == currentBranch {
+			cur = ref
+		} else {
+			others = append(others, ref)
+		}
+	}
+	if cur.Tip == "" {
+		out, err := r.outputTrimmed(ctx, "rev-parse", "HEAD", "HEAD^{tree}")
+		if err != nil {
+			return m, err
+		}
+		ids := strings.Fields(out)
+		if len(ids) != 2 {
+			return m, fmt.Errorf("mob-consensus: unexpected rev-parse output %q", out)
+		}
+		cur.Tip, cur.Tree = ids[0], ids[1]
+	}
+
+	trees := map[string]bool{}
+	for _, ref := range append([]relatedRef{cur}, others...) {
+		m.Branches = append(m.Branches, ref.Branch)
+		m.Tips = append(m.Tips, ref.Tip)
+		trees[ref.Tree] = true
+	}
+	m.Consensus = len(trees) == 1
+
+	type pair struct{ a, b string }
+	var pairs []pair
+	seen := map[pair]bool{}
+	for i := range m.Tips {
+		for j := i + 1; j < len(m.Tips); j++ {
+			p := pair{m.Tips[i], m.Tips[j]}
+			if p.a != p.b && !seen[p] {
+				seen[p] = true
+				pairs = append(pairs, p)
+			}
+		}
+	}
+	counts := make([][2]int, len(pairs))
+	err = parallel(ctx, len(pairs), runtime.GOMAXPROCS(0), func(ctx context.Context, i int) error {
+		var err error
+		counts[i][0], counts[i][1], err = r.leftRightCount(ctx, pairs[i].a, pairs[i].b)
+		return err
+	})
+	if err != nil {
+		return m, err
+	}
+	byPair := map[pair][2]int{}
+	for i, p := range pairs {
+		byPair[p] = counts[i]
+	}
+
+	m.Ahead = make([][]int, len(m.Branches))
+	for i := range m.Ahead {
+		m.Ahead[i] = make([]int, len(m.Branches))
+	}
+	for i := range m.Tips {
+		for j := i + 1; j < len(m.Tips); j++ {
+			c := byPair[pair{m.Tips[i], m.Tips[j]}]
+			m.Ahead[i][j], m.Ahead[j][i] = c[0], c[1]
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,249 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BranchNotFoundError is returned when the user names a merge target that
+// cannot be resolved as a local ref or an unambiguous remote ref.
+type BranchNotFoundError struct {
+	Branch  string
+	Remotes []string
+}
+
+// Error implements the error interface with a machine-friendly message.
+func (e BranchNotFoundError) Error() string {
+	if len(e.Remotes) == 0 {
+		return fmt.Sprintf("mob-consensus: branch %q not found locally and no remotes configured (hint: git remote -v)", e.Branch)
+	}
+
+	return fmt.Sprintf(
+		"mob-consensus: branch %q not found locally or on any remote (%s) (hint: git fetch --all; or use an explicit ref like <remote>/%s)",
+		e.Branch,
+		strings.Join(sortedCopy(e.Remotes), ", "),
+		e.Branch,
+	)
+}
+
+// Msg returns a friendlier message than Error() and includes a next-step hint.
+func (e BranchNotFoundError) Msg() string {
+	return fmt.Sprintf(
+		"mob-consensus: branch %q does not exist.\n\nPick a branch name from the list above (the same list shown by running `mob-consensus status`), then re-run:\n  mob-consensus merge <branch>",
+		e.Branch,
+	)
+}
+
+// MergePlan describes a consensus merge before anything touches the worktree.
+type MergePlan struct {
+	// Requested is the merge target as the user typed it.
+	Requested string
+	// Target is the resolved ref to merge. For an octopus merge (see
+	// OctopusPlan) it lists every target, comma-separated, for display.
+	Target string
+	// Targets are the resolved refs passed to `git merge`: [Target], or each
+	// target of an octopus merge.
+	Targets []string
+	// NeedsConfirm is true when Target was resolved to a remote-tracking ref
+	// and the UI should ask the user to confirm the resolution.
+	NeedsConfirm bool
+	// CurrentBranch is the branch being merged onto.
+	CurrentBranch string
+	// CoAuthors holds the sorted, de-duplicated Co-authored-by trailers.
+	CoAuthors []string
+	// Message is the full merge commit message (subject + trailers).
+	Message []byte
+}
+
+// PlanMerge resolves otherBranch and builds the merge commit message for
+// merging it onto currentBranch. Resolution errors (including
+// BranchNotFoundError) are returned unchanged.
+func (r Runner) PlanMerge(ctx context.Context, otherBranch, currentBranch string) (MergePlan, error) {
+	plan := MergePlan{Requested: otherBranch, CurrentBranch: currentBranch}
+
+	target, needsConfirm, err := r.ResolveMergeTarget(ctx, otherBranch)
+	if err != nil {
+		return plan, err
+	}
+	plan.Target = target
+	plan.Targets = []string{target}
+	plan.NeedsConfirm = needsConfirm
+
+	coauthors, err := r.CoAuthors(ctx, target)
+	if err != nil {
+		return plan, err
+	}
+	plan.CoAuthors = coauthors
+	plan.Message = MergeMessage(target, currentBranch, coauthors)
+	return plan, nil
+}
+
+// OctopusPlan combines the plans of several targets (each from PlanMerge,
+// onto the same branch) into one octopus merge. Its Co-authored-by trailers
+// are the union across all targets.
+func OctopusPlan(plans []MergePlan) MergePlan {
+	var requested, targets, coauthors []string
+	octopus := MergePlan{}
+	for _, p := range plans {
+		requested = append(requested, p.Requested)
+		targets = append(targets, p.Targets...)
+		coauthors = append(coauthors, p.CoAuthors...)
+		octopus.NeedsConfirm = octopus.NeedsConfirm || p.NeedsConfirm
+		octopus.CurrentBranch = p.CurrentBranch
+	}
+	octopus.Requested = strings.Join(requested, ", ")
+	octopus.Target = strings.Join(targets, ", ")
+	octopus.Targets = targets
+	octopus.CoAuthors = CoAuthorLines(strings.Join(coauthors, "\n"), "")
+	octopus.Message = MergeMessage(octopus.Target, octopus.CurrentBranch, octopus.CoAuthors)
+	return octopus
+}
+
+// ResolveMergeTarget resolves a user-supplied merge target.
+//
+// If otherBranch is a valid local ref, it is returned as-is. Otherwise we try
+// to resolve it to exactly one "<remote>/<otherBranch>" among the configured
+// remotes. When a remote candidate is selected, needsConfirm is true so the UI
+// can ask the user to confirm the resolution.
+func (r Runner) ResolveMergeTarget(ctx context.Context, otherBranch string) (string, bool, error) {
+	if _, err := r.output(ctx, "rev-parse", "--verify", otherBranch); err == nil {
+		return otherBranch, false, nil
+	}
+
+	remotes, err := r.Remotes(ctx)
+	if err != nil || len(remotes) == 0 {
+		return "", false, BranchNotFoundError{Branch: otherBranch}
+	}
+
+	var candidates []string
+	for _, remote := range remotes {
+		candidate := remote + "/" + otherBranch
+		if _, err := r.output(ctx, "rev-parse", "--verify", candidate); err == nil {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	switch len(candidates) {
+	case 1:
+		return candidates[0], true, nil
+	case 0:
+		return "", false, BranchNotFoundError{Branch: otherBranch, Remotes: remotes}
+	default:
+		sort.Strings(candidates)
+		return "", false, fmt.Errorf(
+			"mob-consensus: branch %q is ambiguous; found multiple candidates: %s (use an explicit ref)",
+			otherBranch,
+			strings.Join(candidates, ", "),
+		)
+	}
+}
+
+// CoAuthors returns the Co-authored-by trailers for commits in HEAD..target,
+// excluding the current user's email when it is configured.
+func (r Runner) CoAuthors(ctx context.Context, target string) ([]string, error) {
+	userEmail, err := r.outputTrimmed(ctx, "config", "--get", "user.email")
+	if err != nil {
+		userEmail = ""
+	}
+	logOut, err := r.output(ctx, "log", ".."+target, "--pretty=format:Co-authored-by: %an <%ae>")
+	if err != nil {
+		return nil, err
+	}
+	return CoAuthorLines(logOut, userEmail), nil
+}
+
+// MergeMessage formats the merge commit message: a stable subject line (used
+// by tests and tooling), a blank line, then one trailer per line.
+func MergeMessage(otherBranch, currentBranch string, coauthors []string) []byte {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "mob-consensus merge from %s onto %s\n\n", otherBranch, currentBranch)
+	for _, line := range coauthors {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return []byte(buf.String())
+}
+
+// CoAuthorLines parses `git log` output lines already formatted as
+// `Co-authored-by: ...` and returns a sorted, de-duplicated list, optionally
+// excluding lines containing excludeEmail.
+func CoAuthorLines(gitLogOutput, excludeEmail string) []string {
+	seen := make(map[string]struct{})
+	for _, line := range strings.Split(gitLogOutput, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if excludeEmail != "" && strings.Contains(line, excludeEmail) {
+			continue
+		}
+		seen[line] = struct{}{}
+	}
+
+	out := make([]string, 0, len(seen))
+	for line := range seen {
+		out = append(out, line)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ConflictedPaths returns the paths that still have merge conflicts
+// (`git diff --name-only --diff-filter=U`). Capture them before mergetool
+// resolves them, so the review can tell resolved files from auto-merged ones.
+func (r Runner) ConflictedPaths(ctx context.Context) ([]string, error) {
+	out, err := r.output(ctx, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(out), nil
+}
+
+// MergeReview summarizes an in-progress merge against HEAD once conflicts are
+// resolved.
+type MergeReview struct {
+	// Stat is the `git diff --stat HEAD` output.
+	Stat string
+	// Resolved are the paths that conflicted (and were resolved by hand).
+	Resolved []string
+	// AutoMerged are the other changed paths, merged by git without
+	// conflicts.
+	AutoMerged []string
+}
+
+// ReviewMerge splits the changes vs HEAD into conflicted (as captured by
+// ConflictedPaths before resolution) and auto-merged paths.
+func (r Runner) ReviewMerge(ctx context.Context, conflicted []string) (MergeReview, error) {
+	stat, err := r.output(ctx, "diff", "--stat", "HEAD")
+	if err != nil {
+		return MergeReview{}, err
+	}
+	changed, err := r.output(ctx, "diff", "--name-only", "HEAD")
+	if err != nil {
+		return MergeReview{}, err
+	}
+	review := MergeReview{Stat: strings.TrimRight(stat, "\n"), Resolved: conflicted}
+	isConflicted := map[string]bool{}
+	for _, path := range conflicted {
+		isConflicted[path] = true
+	}
+	for _, path := range splitLines(changed) {
+		if !isConflicted[path] {
+			review.AutoMerged = append(review.AutoMerged, path)
+		}
+	}
+	return review, nil
+}
+
+// splitLines returns the non-empty, trimmed lines of s.
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
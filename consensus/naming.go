@@ -0,0 +1,177 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ConfigBranchTemplate is the git config key for the personal branch naming
+// template. Every collaborator on a twig should use the same template.
+const ConfigBranchTemplate = "mob-consensus.branchTemplate"
+
+// DefaultBranchTemplate names personal branches "<user>/<twig>".
+const DefaultBranchTemplate = "{user}/{twig}"
+
+// Naming maps a <user> and a twig to a personal branch name and back,
+// following a template such as "{user}/{twig}", "mob/{twig}/{user}", or
+// "users/{user}/{twig}". The template holds {user} and {twig} once each,
+// separated by "/", with any literal text before and after. Twigs may
+// contain slashes (ex: "feature/login"); users may not. The zero Naming
+// is DefaultBranchTemplate.
+type Naming struct {
+	// Template is the template as configured; empty means the default.
+	Template string
+
+	prefix, suffix string
+	twigFirst      bool
+}
+
+// ParseNaming parses a branch naming template.
+func ParseNaming(template string) (Naming, error) {
+	n := Naming{Template: template}
+	bad := func(why string) (Naming, error) {
+		return Naming{}, fmt.Errorf("mob-consensus: invalid %s %q: %s (ex: %s, mob/{twig}/{user}, users/{user}/{twig})", ConfigBranchTemplate, template, why, DefaultBranchTemplate)
+	}
+	if strings.Count(template, "{user}") != 1 || strings.Count(template, "{twig}") != 1 {
+		return bad("it needs {user} and {twig} exactly once each")
+	}
+	var rest string
+	if i := strings.Index(template, "{user}/{twig}"); i >= 0 {
+		n.prefix, rest = template[:i], template[i+len("{user}/{twig}"):]
+	} else if i := strings.Index(template, "{twig}/{user}"); i >= 0 {
+		n.prefix, rest, n.twigFirst = template[:i], template[i+len("{twig}/{user}"):], true
+	} else {
+		return bad("{user} and {twig} must be separated by a single /")
+	}
+	n.suffix = rest
+	if strings.ContainsAny(n.prefix+n.suffix, "{}") {
+		return bad("only {user} and {twig} may appear in braces")
+	}
+	return n, nil
+}
+
+// DefaultNaming returns the Naming for DefaultBranchTemplate.
+func DefaultNaming() Naming {
+	return Naming{Template: DefaultBranchTemplate}
+}
+
+// Naming returns the naming configured by ConfigBranchTemplate, or
+// DefaultNaming when it is unset.
+func (r Runner) Naming(ctx context.Context) (Naming, error) {
+	template, _ := r.outputTrimmed(ctx, "config", "--get", ConfigBranchTemplate)
+	if template == "" {
+		return DefaultNaming(), nil
+	}
+	return ParseNaming(template)
+}
+
+// Branch returns user's personal branch on twig.
+func (n Naming) Branch(user, twig string) string {
+	if n.twigFirst {
+		return n.prefix + twig + "/" + user + n.suffix
+	}
+	return n.prefix + user + "/" + twig + n.suffix
+}
+
+// Parse splits a personal branch name (a local name, without any
+// "remotes/<remote>/" prefix) into its user and twig. ok is false when name
+// doesn't follow the template. Claim branches (see ClaimsNamespace) are never
+// personal branches.
+func (n Naming) Parse(name string) (user, twig string, ok bool) {
+	if strings.HasPrefix(name, ClaimsNamespace+"/") {
+		return "", "", false
+	}
+	rest, ok := strings.CutPrefix(name, n.prefix)
+	if !ok {
+		return "", "", false
+	}
+	if rest, ok = strings.CutSuffix(rest, n.suffix); !ok {
+		return "", "", false
+	}
+	if !n.twigFirst {
+		user, twig, ok = strings.Cut(rest, "/")
+	} else if i := strings.LastIndexByte(rest, '/'); i >= 0 {
+		twig, user, ok = rest[:i], rest[i+1:], true
+	}
+	if !ok || user == "" || twig == "" {
+		return "", "", false
+	}
+	return user, twig, true
+}
+
+// Twig returns the twig of a branch as listed by `git branch -a`: the twig
+// of a personal branch, else the branch's own name (it is taken to be the
+// shared twig). Examples with the default template:
+//   - "alice/feature-x"                => "feature-x"
+//   - "remotes/origin/alice/feature-x" => "feature-x"
+//   - "alice/feature/login"            => "feature/login"
+//   - "feature-x"                      => "feature-x"
+func (n Naming) Twig(branch string) string {
+	_, name := splitRemote(strings.TrimSpace(branch))
+	if _, twig, ok := n.Parse(name); ok {
+		return twig
+	}
+	return name
+}
+
+// twigAmong is Twig for a branch in a repo with refs: a branch that some
+// personal branch in refs is on is itself a shared twig and stays whole.
+// With the default template, "feature/login" is then the twig
+// "feature/login" rather than "feature"'s branch on twig "login".
+func (n Naming) twigAmong(branch string, refs []relatedRef) string {
+	_, name := splitRemote(strings.TrimSpace(branch))
+	for _, ref := range refs {
+		_, other := splitRemote(ref.Branch)
+		if _, twig, ok := n.Parse(other); ok && twig == name {
+			return name
+		}
+	}
+	return n.Twig(branch)
+}
+
+// Twig returns the twig of branch under naming n, like Naming.Twig, except
+// that a shared twig whose name looks like a personal branch (ex:
+// "feature/login" under "{user}/{twig}") is recognized as soon as someone
+// has a personal branch on it (ex: "alice/feature/login").
+func (r Runner) Twig(ctx context.Context, n Naming, branch string) (string, error) {
+	refs, _, err := r.branchRefs(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	return n.twigAmong(branch, refs), nil
+}
+
+// Related reports whether branch, as listed by `git branch -a`, belongs to
+// twig: a personal branch on twig, or a remote-tracking copy of the shared
+// twig itself (ex: "remotes/origin/feature-x").
+func (n Naming) Related(branch, twig string) bool {
+	remote, name := splitRemote(branch)
+	if remote != "" && name == twig {
+		return true
+	}
+	_, t, ok := n.Parse(name)
+	return ok && t == twig
+}
+
+// SplitBranch splits a related branch of twig, as listed by `git branch -a`,
+// into its remote (empty for local branches) and <user>. For a remote copy
+// of the shared twig, user is the twig.
+func (n Naming) SplitBranch(branch, twig string) (remote, user string) {
+	remote, name := splitRemote(strings.TrimSpace(branch))
+	if u, t, ok := n.Parse(name); ok && t == twig {
+		return remote, u
+	}
+	return remote, name
+}
+
+// splitRemote splits "remotes/<remote>/<name>" into remote and name; other
+// branches have no remote.
+func splitRemote(branch string) (remote, name string) {
+	if rest, ok := strings.CutPrefix(branch, "remotes/"); ok {
+		if i := strings.IndexByte(rest, '/'); i > 0 {
+			return rest[:i], rest[i+1:]
+		}
+	}
+	return "", branch
+}
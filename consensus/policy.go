@@ -0,0 +1,161 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Git config keys for the remote policy. They live in repo-local config (or
+// any other git config scope) next to the remotes they name.
+const (
+	// ConfigPushRemote names the only remote mob-consensus pushes to
+	// (normally your fork). When unset, remote.pushDefault is used.
+	ConfigPushRemote = "mob-consensus.pushRemote"
+	// ConfigFetchRemotes lists the remotes status/merge fetch (space or comma
+	// separated; may be given more than once).
+	ConfigFetchRemotes = "mob-consensus.fetchRemotes"
+	// ConfigTwigRemote names the remote the shared twig is fetched from when
+	// joining (fetch-only; the twig is never pushed there).
+	ConfigTwigRemote = "mob-consensus.twigRemote"
+)
+
+// RemotePolicy separates the remotes mob-consensus fetches from, pushes to,
+// and takes the shared twig from. Empty fields mean "not configured"; callers
+// then fall back to the single-remote heuristics (upstream or sole remote).
+type RemotePolicy struct {
+	PushRemote string
+	// PushRemoteSource is the config key PushRemote came from
+	// (ConfigPushRemote or "remote.pushDefault").
+	PushRemoteSource string
+	FetchRemotes     []string
+	TwigRemote       string
+}
+
+// Policy reads the remote policy from git config and checks that every remote
+// it names is configured.
+func (r Runner) Policy(ctx context.Context) (RemotePolicy, error) {
+	var p RemotePolicy
+	if v, _ := r.outputTrimmed(ctx, "config", "--get", ConfigPushRemote); v != "" {
+		p.PushRemote, p.PushRemoteSource = v, ConfigPushRemote
+	} else if v, _ := r.outputTrimmed(ctx, "config", "--get", "remote.pushDefault"); v != "" {
+		p.PushRemote, p.PushRemoteSource = v, "remote.pushDefault"
+	}
+	fetch, _ := r.outputTrimmed(ctx, "config", "--get-all", ConfigFetchRemotes)
+	seen := map[string]bool{}
+	for _, remote := range strings.FieldsFunc(fetch, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' || c == '\n' }) {
+		if !seen[remote] {
+			seen[remote] = true
+			p.FetchRemotes = append(p.FetchRemotes, remote)
+		}
+	}
+	p.TwigRemote, _ = r.outputTrimmed(ctx, "config", "--get", ConfigTwigRemote)
+
+	if p.PushRemote == "" && len(p.FetchRemotes) == 0 && p.TwigRemote == "" {
+		return p, nil
+	}
+	remotes, err := r.Remotes(ctx)
+	if err != nil {
+		return RemotePolicy{}, err
+	}
+	known := map[string]bool{}
+	for _, remote := range remotes {
+		known[remote] = true
+	}
+	check := func(key, remote string) error {
+		if remote == "" || known[remote] {
+			return nil
+		}
+		return fmt.Errorf("mob-consensus: %s names remote %q, which is not configured (available: %s; hint: git remote add %s <url>, or git config --local --unset-all %s)",
+			key, remote, strings.Join(sortedCopy(remotes), ", "), remote, key)
+	}
+	if err := check(p.PushRemoteSource, p.PushRemote); err != nil {
+		return RemotePolicy{}, err
+	}
+	for _, remote := range p.FetchRemotes {
+		if err := check(ConfigFetchRemotes, remote); err != nil {
+			return RemotePolicy{}, err
+		}
+	}
+	if err := check(ConfigTwigRemote, p.TwigRemote); err != nil {
+		return RemotePolicy{}, err
+	}
+	return p, nil
+}
+
+// PushPolicyError reports a push blocked by the push-remote policy.
+type PushPolicyError struct {
+	// Remote is the remote the push targeted.
+	Remote string
+	// PushRemote and Source are the allowed remote and the config key that
+	// set it.
+	PushRemote string
+	Source     string
+}
+
+// Error implements the error interface.
+func (e PushPolicyError) Error() string {
+	return fmt.Sprintf("mob-consensus: refusing to push to %q: %s allows pushes only to %q (hint: use --remote %s, or change the policy with: git config --local %s <remote>)",
+		e.Remote, e.Source, e.PushRemote, e.PushRemote, e.Source)
+}
+
+// CheckPush returns a PushPolicyError unless remote is the push remote. Any
+// remote is allowed when no push remote is configured.
+func (p RemotePolicy) CheckPush(remote string) error {
+	if p.PushRemote == "" || remote == p.PushRemote {
+		return nil
+	}
+	return PushPolicyError{Remote: remote, PushRemote: p.PushRemote, Source: p.PushRemoteSource}
+}
+
+// PushTarget returns the remote named by `git push` args (the first
+// non-option argument after "push"), or "" for a bare `git push`. ok is false
+// when args aren't a push.
+func PushTarget(args []string) (remote string, ok bool) {
+	if len(args) == 0 || args[0] != "push" {
+		return "", false
+	}
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg, true
+		}
+	}
+	return "", true
+}
+
+// FetchRemotes returns the remotes `status`/`merge` should fetch. With
+// ConfigFetchRemotes set, that is every listed remote, plus the remote that
+// otherBranch is prefixed with (ex: "jj/alice/feature-x"), if any. Otherwise it
+// is the single remote chosen by FetchRemote.
+func (r Runner) FetchRemotes(ctx context.Context, otherBranch string) ([]string, error) {
+	p, err := r.Policy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.FetchRemotes) == 0 {
+		remote, err := r.FetchRemote(ctx, otherBranch)
+		if err != nil {
+			return nil, err
+		}
+		return []string{remote}, nil
+	}
+
+	out := append([]string(nil), p.FetchRemotes...)
+	if i := strings.IndexByte(otherBranch, '/'); i > 0 {
+		remotes, err := r.Remotes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		prefix := otherBranch[:i]
+		listed := false
+		for _, remote := range out {
+			listed = listed || remote == prefix
+		}
+		for _, remote := range remotes {
+			if remote == prefix && !listed {
+				out = append(out, remote)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,76 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PushArgs returns the `git push` arguments for pushing the current branch.
+//
+// When a push remote is configured (ConfigPushRemote or remote.pushDefault),
+// the branch is always pushed there explicitly: plain `push` only if the
+// upstream is already on the push remote, `push <remote> <branch>` if the
+// upstream is elsewhere (ex: a read-only `upstream`), and
+// `push -u <remote> <branch>` if there is no upstream yet.
+//
+// Without a push remote, an existing upstream means plain `push`. Otherwise it
+// sets an upstream with `push -u <remote> <branch>` only when the remote is
+// unambiguous (branch.<name>.pushRemote or a sole remote). If the remote
+// choice is ambiguous it returns a clear error with exact commands the user
+// can run.
+func (r Runner) PushArgs(ctx context.Context) ([]string, error) {
+	policy, err := r.Policy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := r.outputTrimmed(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	hasUpstream := err == nil && upstream != ""
+	if hasUpstream && policy.PushRemote == "" {
+		return []string{"push"}, nil
+	}
+
+	currentBranch, err := r.CurrentBranch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if currentBranch == "" || currentBranch == "HEAD" {
+		return nil, errors.New("mob-consensus: cannot push from detached HEAD")
+	}
+
+	if policy.PushRemote != "" {
+		switch {
+		case !hasUpstream:
+			return []string{"push", "-u", policy.PushRemote, currentBranch}, nil
+		case strings.HasPrefix(upstream, policy.PushRemote+"/"):
+			return []string{"push"}, nil
+		default:
+			return []string{"push", policy.PushRemote, currentBranch}, nil
+		}
+	}
+
+	branchPushRemote, err := r.outputTrimmed(ctx, "config", "--get", "branch."+currentBranch+".pushRemote")
+	if err == nil && branchPushRemote != "" {
+		return []string{"push", "-u", branchPushRemote, currentBranch}, nil
+	}
+
+	remotes, err := r.Remotes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("mob-consensus: cannot list git remotes: %w", err)
+	}
+	switch len(remotes) {
+	case 0:
+		return nil, errors.New("mob-consensus: cannot push: no git remotes configured (hint: git remote -v)")
+	case 1:
+		return []string{"push", "-u", remotes[0], currentBranch}, nil
+	}
+
+	return nil, fmt.Errorf(
+		"mob-consensus: cannot push: no upstream is set for branch %q and multiple remotes exist: %s (hint: git push -u <remote> %s; or: git config --local %s <remote>)",
+		currentBranch,
+		strings.Join(sortedCopy(remotes), ", "),
+		currentBranch,
+		ConfigPushRemote,
+	)
+}
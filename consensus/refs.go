@@ -0,0 +1,157 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// relatedRef is one branch as read by branchRefs.
+type relatedRef struct {
+	// Branch is the name as `git branch -a` lists it (ex: "bob/twig" or
+	// "remotes/origin/bob/twig").
+	Branch string
+	Tip    string
+	Tree   string
+	// Author, Time, and Subject describe the tip commit: its author name,
+	// committer date, and subject line.
+	Author  string
+	Time    time.Time
+	Subject string
+	// AheadCommits and BehindCommits compare the branch to HEAD; they are
+	// only set when branchRefs reports counted.
+	AheadCommits  int
+	BehindCommits int
+}
+
+// The for-each-ref formats read by branchRefs. Fields are tab-separated;
+// the subject comes last so it may contain anything but a newline.
+const (
+	refsFields        = "%(objectname)%09%(tree)%09%(symref)%09%(refname)%09%(authorname)%09%(committerdate:unix)"
+	refsFormat        = refsFields + "%09%(contents:subject)"
+	aheadBehindFormat = refsFields + "%09%(ahead-behind:HEAD)%09%(contents:subject)"
+)
+
+// relatedRefs lists the local and remote-tracking branches related to twig
+// under naming n (see Naming.Related), in `git branch -a` order. See
+// branchRefs for withCounts.
+func (r Runner) relatedRefs(ctx context.Context, n Naming, twig string, withCounts bool) (refs []relatedRef, counted bool, err error) {
+	all, counted, err := r.branchRefs(ctx, withCounts)
+	if err != nil {
+		return nil, false, err
+	}
+	return relatedIn(n, twig, all), counted, nil
+}
+
+// relatedIn returns the refs in all that are related to twig under naming n.
+func relatedIn(n Naming, twig string, all []relatedRef) []relatedRef {
+	var refs []relatedRef
+	for _, ref := range all {
+		if n.Related(ref.Branch, twig) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// branchRefs lists every local and remote-tracking branch, in `git branch
+// -a` order, with one `git for-each-ref`. When withCounts is set it also asks
+// git for the ahead/behind counts against HEAD in the same pass; that needs
+// git 2.41 or later, so on older git it falls back to a plain listing and
+// counted is false.
+func (r Runner) branchRefs(ctx context.Context, withCounts bool) (refs []relatedRef, counted bool, err error) {
+	var out string
+	if withCounts {
+		out, err = r.output(ctx, "for-each-ref", "--format="+aheadBehindFormat, "refs/heads", "refs/remotes")
+		counted = err == nil
+	}
+	if !counted {
+		if out, err = r.output(ctx, "for-each-ref", "--format="+refsFormat, "refs/heads", "refs/remotes"); err != nil {
+			return nil, false, err
+		}
+	}
+
+	n := 7
+	if counted {
+		n = 8
+	}
+	for _, line := range splitLines(out) {
+		fields := strings.SplitN(line, "\t", n)
+		if len(fields) != n {
+			return nil, false, fmt.Errorf("mob-consensus: unexpected for-each-ref output %q", line)
+		}
+		if fields[2] != "" {
+			// Symbolic refs like remotes/origin/HEAD.
+			continue
+		}
+		name, ok := strings.CutPrefix(fields[3], "refs/heads/")
+		if !ok {
+			name = strings.TrimPrefix(fields[3], "refs/")
+		}
+		ref := relatedRef{Branch: name, Tip: fields[0], Tree: fields[1], Author: fields[4], Subject: fields[n-1]}
+		unix, err := strconv.ParseInt(fields[5], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("mob-consensus: unexpected committer date %q for %s", fields[5], name)
+		}
+		ref.Time = time.Unix(unix, 0)
+		if counted {
+			ab := strings.Fields(fields[6])
+			if len(ab) != 2 {
+				return nil, false, fmt.Errorf("mob-consensus: unexpected ahead-behind %q for %s", fields[6], name)
+			}
+			if ref.AheadCommits, err = strconv.Atoi(ab[0]); err != nil {
+				return nil, false, err
+			}
+			if ref.BehindCommits, err = strconv.Atoi(ab[1]); err != nil {
+				return nil, false, err
+			}
+		}
+		refs = append(refs, ref)
+	}
+	return refs, counted, nil
+}
+
+// parallel calls fn(ctx, i) for every i in [0, n) on at most limit
+// goroutines. After the first failure, or once ctx is done, it starts no
+// more calls and cancels the ctx passed to running ones. It returns ctx's
+// error if ctx was done, else the first failure.
+func parallel(ctx context.Context, n, limit int, fn func(ctx context.Context, i int) error) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+		sem   = make(chan struct{}, max(limit, 1))
+	)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					first = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	return first
+}
@@ -0,0 +1,138 @@
+package consensus
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// ConfigReview makes `merge` run the built-in hunk-by-hunk review (as if
+// --review were given) when set to true.
+const ConfigReview = "mob-consensus.review"
+
+// FileDiff is one file's section of a unified diff.
+type FileDiff struct {
+	// Path is the file's path relative to the top of the working tree (the
+	// new path, or the old one for deletions).
+	Path string
+	// Header holds the lines before the first hunk ("diff --git", "index",
+	// "---", "+++", mode lines, ...), each ending in "\n".
+	Header string
+	Hunks  []Hunk
+}
+
+// Hunk is one "@@ ... @@" section of a FileDiff.
+type Hunk struct {
+	// Text is the hunk including its "@@" line, each line ending in "\n".
+	Text string
+}
+
+// Patch returns a patch that contains only hunk h of f, suitable for
+// `git apply`.
+func (f FileDiff) Patch(h Hunk) string {
+	return f.Header + h.Text
+}
+
+// ParseDiff splits `git diff` output (without color or external diff
+// drivers) into files and hunks. Files without hunks (binary files, mode-only
+// changes) have a Header but no Hunks.
+func ParseDiff(diff string) []FileDiff {
+	var files []FileDiff
+	var cur *FileDiff
+	var hunk *strings.Builder
+	flush := func() {
+		if cur != nil && hunk != nil {
+			cur.Hunks = append(cur.Hunks, Hunk{Text: hunk.String()})
+		}
+		hunk = nil
+	}
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			files = append(files, FileDiff{Path: diffGitPath(line)})
+			cur = &files[len(files)-1]
+			cur.Header = line
+			continue
+		case cur == nil:
+			continue
+		case strings.HasPrefix(line, "@@"):
+			flush()
+			hunk = &strings.Builder{}
+		}
+		if hunk != nil {
+			hunk.WriteString(line)
+			continue
+		}
+		cur.Header += line
+		if p, ok := strings.CutPrefix(line, "+++ b/"); ok {
+			cur.Path = strings.TrimSuffix(p, "\n")
+		} else if p, ok := strings.CutPrefix(line, "--- a/"); ok && cur.Path == "" {
+			cur.Path = strings.TrimSuffix(p, "\n")
+		}
+	}
+	flush()
+	return files
+}
+
+// diffGitPath extracts the "b/" path from a "diff --git a/x b/x" line. It
+// only handles unquoted paths; ParseDiff prefers the "+++"/"---" lines when
+// they exist.
+func diffGitPath(line string) string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "diff --git "), "\n")
+	if i := strings.LastIndex(line, " b/"); i >= 0 {
+		return line[i+len(" b/"):]
+	}
+	return ""
+}
+
+// StagedChanges returns what the next commit would record, per file and hunk
+// (`git diff --cached HEAD`), optionally limited to paths relative to the top
+// of the working tree (as in FileDiff.Path).
+func (r Runner) StagedChanges(ctx context.Context, paths ...string) ([]FileDiff, error) {
+	args := []string{"diff", "--cached", "--no-color", "--no-ext-diff", "HEAD"}
+	if len(paths) > 0 {
+		args = append(args, "--")
+		for _, p := range paths {
+			args = append(args, ":(top,literal)"+p)
+		}
+	}
+	out, err := r.output(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDiff(out), nil
+}
+
+// RevertHunk undoes one staged hunk in both the index and the working tree
+// (`git apply -R --index`).
+func (r Runner) RevertHunk(ctx context.Context, f FileDiff, h Hunk) error {
+	top, err := r.outputTrimmed(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	gitDir, err := r.GitDir(ctx)
+	if err != nil {
+		return err
+	}
+	patch, err := os.CreateTemp(gitDir, "mob-consensus-*.patch")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(patch.Name())
+	if _, err := patch.WriteString(f.Patch(h)); err != nil {
+		_ = patch.Close()
+		return err
+	}
+	if err := patch.Close(); err != nil {
+		return err
+	}
+	_, err = r.output(ctx, "-C", top, "apply", "-R", "--index", patch.Name())
+	return err
+}
@@ -0,0 +1,496 @@
+package consensus
+
+// Tests for Runner methods, driven by a scripted fake Git backend so they run
+// in parallel without touching the filesystem or the process cwd.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGit is a scripted Git backend. Output looks up the space-joined args in
+// outputs; unknown commands fail like a missing ref would. Run records the
+// args it was called with.
+type fakeGit struct {
+	dir     string
+	outputs map[string]string
+
+	mu  sync.Mutex
+	ran []string
+}
+
+// Dir implements Git.
+func (f *fakeGit) Dir() string { return f.dir }
+
+// Output implements Git.
+func (f *fakeGit) Output(_ context.Context, args ...string) (string, error) {
+	key := strings.Join(args, " ")
+	out, ok := f.outputs[key]
+	if !ok {
+		return "", fmt.Errorf("git %s: exit status 128: fatal: scripted failure", key)
+	}
+	return out, nil
+}
+
+// Run implements Git.
+func (f *fakeGit) Run(_ context.Context, args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ran = append(f.ran, strings.Join(args, " "))
+	return nil
+}
+
+// fakeCase is one Runner call against a scripted fakeGit. want must be
+// deeply equal to the call's result, down to its types; wantErr, when set, is
+// a substring of the expected error.
+type fakeCase struct {
+	name    string
+	dir     string
+	outputs map[string]string
+	call    func(ctx context.Context, r Runner) (any, error)
+	want    any
+	wantErr string
+}
+
+// runFakeCases runs each case in parallel against its own fakeGit.
+func runFakeCases(t *testing.T, tests []fakeCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			g := &fakeGit{dir: tt.dir, outputs: tt.outputs}
+			got, err := tt.call(context.Background(), Runner{Git: g})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err=%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err=%v", err)
+			}
+			if d := diffValues("result", reflect.ValueOf(got), reflect.ValueOf(tt.want)); d != "" {
+				t.Fatal(d)
+			}
+		})
+	}
+}
+
+// diffValues describes the first difference between got and want by its
+// path (ex: "result[1].Tip"), or returns "" when they are deeply equal.
+// Values are shown with %#v, so nil and empty slices, and equal times in
+// different locations, tell apart.
+func diffValues(path string, got, want reflect.Value) string {
+	switch {
+	case !got.IsValid() || !want.IsValid():
+		if got.IsValid() == want.IsValid() {
+			return ""
+		}
+	case got.Type() != want.Type():
+	case got.Kind() == reflect.Slice && !got.IsNil() && !want.IsNil():
+		for i := 0; i < got.Len() && i < want.Len(); i++ {
+			if d := diffValues(fmt.Sprintf("%s[%d]", path, i), got.Index(i), want.Index(i)); d != "" {
+				return d
+			}
+		}
+		if got.Len() == want.Len() {
+			return ""
+		}
+	case got.Kind() == reflect.Struct && allExported(got.Type()):
+		for i := 0; i < got.NumField(); i++ {
+			if d := diffValues(path+"."+got.Type().Field(i).Name, got.Field(i), want.Field(i)); d != "" {
+				return d
+			}
+		}
+		return ""
+	case reflect.DeepEqual(got.Interface(), want.Interface()):
+		return ""
+	}
+	return fmt.Sprintf("%s: got %s, want %s", path, formatValue(got), formatValue(want))
+}
+
+// allExported reports whether diffValues can walk every field of t.
+func allExported(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			return false
+		}
+	}
+	return true
+}
+
+// formatValue shows v for diffValues; the invalid value is an untyped nil.
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	return fmt.Sprintf("%#v", v.Interface())
+}
+
+// TestRunnerFake covers how Runner methods read and shape git output. What
+// the results mean (ex: ahead/behind counts) is checked against real repos in
+// the integration tests.
+func TestRunnerFake(t *testing.T) {
+	t.Parallel()
+
+	refs := "for-each-ref --format=" + refsFormat + " refs/heads refs/remotes"
+	runFakeCases(t, []fakeCase{
+		{
+			name: "Discover stops when ctx is cancelled",
+			outputs: map[string]string{
+				"rev-parse HEAD": "aaaa\n",
+				"for-each-ref --format=" + aheadBehindFormat + " refs/heads refs/remotes": "bbbb\ttree2\t\trefs/heads/bob/twig\tDev\t1700000000\t1 0\tchange\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+				return r.Discover(ctx, "alice/twig")
+			},
+			wantErr: context.Canceled.Error(),
+		},
+		{
+			name: "Claims sorts by item, claimant, and remote",
+			outputs: map[string]string{
+				"for-each-ref --format=%(refname) %(objectname) %(committerdate:unix) refs/remotes/origin/claims/ refs/remotes/bob/claims/": "" +
+					"refs/remotes/origin/claims/009/alice aaaa 100\n" +
+					"refs/remotes/bob/claims/009/bob bbbb 200\n" +
+					"refs/remotes/origin/claims/001/carol cccc 300\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.Claims(ctx, "origin", "bob")
+			},
+			want: []Claim{
+				{Item: "001", Who: "carol", Remote: "origin", Tip: "cccc", Date: time.Unix(300, 0)},
+				{Item: "009", Who: "alice", Remote: "origin", Tip: "aaaa", Date: time.Unix(100, 0)},
+				{Item: "009", Who: "bob", Remote: "bob", Tip: "bbbb", Date: time.Unix(200, 0)},
+			},
+		},
+		{
+			name: "ClaimCommit commits the empty tree",
+			outputs: map[string]string{
+				"hash-object -w -t tree " + os.DevNull:       "tree0\n",
+				"commit-tree tree0 -m claim item/1 by alice": "cccc\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.ClaimCommit(ctx, "item/1", "alice")
+			},
+			want: "cccc",
+		},
+		{
+			name: "TeamSync reuses, updates, and adds remotes",
+			outputs: map[string]string{
+				"remote":                               "origin\nbob\n",
+				"config --get remote.origin.url":       "https://example.com/alice.git\n",
+				"config --get remote.bob.url":          "https://example.com/old-bob.git\n",
+				"config --get-all remote.origin.fetch": "+refs/heads/*:refs/remotes/origin/*\n",
+				"config --get-all remote.bob.fetch":    "+refs/heads/main:refs/remotes/bob/main\n",
+				"config --get remote.pushDefault":      "bob\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				steps, err := r.TeamSync(ctx, Team{Collaborators: []Collaborator{
+					{User: "alice", URL: "https://example.com/alice.git"},
+					{User: "bob", URL: "https://example.com/bob.git"},
+					{User: "carol", URL: "https://example.com/carol.git"},
+				}}, "alice")
+				var args []string
+				for _, step := range steps {
+					args = append(args, strings.Join(step.Args, " "))
+				}
+				return args, err
+			},
+			want: []string{
+				"config --local remote.pushDefault origin",
+				"remote set-url bob https://example.com/bob.git",
+				"config --local --add remote.bob.fetch +refs/heads/*:refs/remotes/bob/*",
+				"remote add carol https://example.com/carol.git",
+				"config --local --replace-all mob-consensus.fetchRemotes origin bob carol",
+			},
+		},
+		{
+			name: "ReviewMerge splits resolved and auto-merged paths",
+			outputs: map[string]string{
+				"diff --name-only --diff-filter=U": "b.txt\n",
+				"diff --stat HEAD":                 " a.txt | 1 +\n b.txt | 2 +-\n 2 files changed\n",
+				"diff --name-only HEAD":            "a.txt\nb.txt\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				conflicted, err := r.ConflictedPaths(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return r.ReviewMerge(ctx, conflicted)
+			},
+			want: MergeReview{
+				Stat:       " a.txt | 1 +\n b.txt | 2 +-\n 2 files changed",
+				Resolved:   []string{"b.txt"},
+				AutoMerged: []string{"a.txt"},
+			},
+		},
+		{
+			name: "AssistRequest collects the diff, conflicts, and peer commits",
+			outputs: map[string]string{
+				"diff --cached --no-color --no-ext-diff HEAD":              "diff --git a/a.txt b/a.txt\n",
+				"log HEAD..bob/twig --pretty=format:%H%x00%an <%ae>%x00%s": "bbbb\x00Bob <bob@example.com>\x00add parser\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.AssistRequest(ctx, MergePlan{Target: "bob/twig", CurrentBranch: "alice/twig"}, []string{"a.txt"})
+			},
+			want: AssistRequest{
+				SchemaVersion: AssistSchemaVersion,
+				Target:        "bob/twig",
+				CurrentBranch: "alice/twig",
+				Diff:          "diff --git a/a.txt b/a.txt\n",
+				Conflicts:     []string{"a.txt"},
+				Commits:       []AssistCommit{{Hash: "bbbb", Author: "Bob <bob@example.com>", Subject: "add parser"}},
+			},
+		},
+		{
+			name:    "GitPath resolves against the backend directory",
+			dir:     "/repo",
+			outputs: map[string]string{"rev-parse --git-path MERGE_HEAD": ".git/MERGE_HEAD\n"},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.GitPath(ctx, "MERGE_HEAD")
+			},
+			want: "/repo/.git/MERGE_HEAD",
+		},
+		{
+			name: "Matrix compares each pair of tips once",
+			outputs: map[string]string{
+				refs: "" +
+					"aaaa\ttree1\t\trefs/heads/alice/twig\tDev\t1700000000\tchange\n" +
+					"bbbb\ttree2\t\trefs/heads/bob/twig\tDev\t1700000000\tchange\n" +
+					"eeee\ttree5\t\trefs/heads/main\tDev\t1700000000\tchange\n" +
+					"bbbb\ttree2\t\trefs/remotes/origin/bob/twig\tDev\t1700000000\tchange\n",
+				"rev-list --left-right --count aaaa...bbbb": "2\t1\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.Matrix(ctx, "alice/twig")
+			},
+			want: Matrix{
+				CurrentBranch: "alice/twig",
+				Twig:          "twig",
+				Branches:      []string{"alice/twig", "bob/twig", "remotes/origin/bob/twig"},
+				Tips:          []string{"aaaa", "bbbb", "bbbb"},
+				Ahead:         [][]int{{0, 2, 2}, {1, 0, 0}, {1, 0, 0}},
+			},
+		},
+		{
+			name: "TwigBranches skips the shared twig",
+			outputs: map[string]string{
+				refs: "" +
+					"aaaa\ttree1\t\trefs/heads/alice/twig\tDev\t1700000000\tchange\n" +
+					"cccc\ttree3\t\trefs/heads/twig\tDev\t1700000000\tchange\n" +
+					"cccc\ttree3\t\trefs/remotes/origin/twig\tDev\t1700000000\tchange\n" +
+					"bbbb\ttree2\t\trefs/remotes/origin/bob/twig\tDev\t1700000000\tchange\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.TwigBranches(ctx, "twig")
+			},
+			want: []TwigBranch{
+				{Branch: "alice/twig", User: "alice", Tip: "aaaa"},
+				{Branch: "remotes/origin/bob/twig", Remote: "origin", User: "bob", Tip: "bbbb"},
+			},
+		},
+		{
+			name: "Twigs groups personal branches and shared copies",
+			outputs: map[string]string{
+				refs: "" +
+					"aaaa\ttree1\t\trefs/heads/alice/old\tAlice\t1600000000\tchange\n" +
+					"bbbb\ttree2\t\trefs/heads/bob/twig\tBob\t1700000100\tchange\n" +
+					"eeee\ttree5\t\trefs/heads/main\tDev\t1700000000\tchange\n" +
+					"eeee\ttree5\trefs/remotes/origin/main\trefs/remotes/origin/HEAD\tDev\t1700000000\tchange\n" +
+					"cccc\ttree3\t\trefs/remotes/origin/alice/twig\tAlice\t1700000000\tchange\n" +
+					"dddd\ttree4\t\trefs/remotes/origin/claims/item/alice\tAlice\t1700000200\tchange\n" +
+					"ffff\ttree6\t\trefs/remotes/origin/twig\tCarol\t1700000300\tmerge\n",
+			},
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.Twigs(ctx)
+			},
+			want: []TwigSummary{
+				{
+					Twig:  "twig",
+					Users: []string{"alice", "bob"},
+					Branches: []TwigBranch{
+						{Branch: "bob/twig", User: "bob", Tip: "bbbb"},
+						{Branch: "remotes/origin/alice/twig", Remote: "origin", User: "alice", Tip: "cccc"},
+					},
+					SharedRemotes: []string{"origin"},
+					LastActivity:  time.Unix(1700000300, 0),
+					LastAuthor:    "Carol",
+				},
+				{
+					Twig:         "old",
+					Users:        []string{"alice"},
+					Branches:     []TwigBranch{{Branch: "alice/old", User: "alice", Tip: "aaaa"}},
+					LastActivity: time.Unix(1600000000, 0),
+					LastAuthor:   "Alice",
+				},
+			},
+		},
+	})
+}
+
+// TestRunnerPushArgsFake covers each push-remote selection rule.
+func TestRunnerPushArgsFake(t *testing.T) {
+	t.Parallel()
+
+	pushArgs := func(ctx context.Context, r Runner) (any, error) { return r.PushArgs(ctx) }
+	runFakeCases(t, []fakeCase{
+		{
+			name: "upstream",
+			outputs: map[string]string{
+				"rev-parse --abbrev-ref --symbolic-full-name @{u}": "origin/alice/twig\n",
+			},
+			call: pushArgs,
+			want: []string{"push"},
+		},
+		{
+			name: "pushDefault",
+			outputs: map[string]string{
+				"rev-parse --abbrev-ref HEAD":     "alice/twig\n",
+				"config --get remote.pushDefault": "fork\n",
+				"remote":                          "origin\nfork\n",
+			},
+			call: pushArgs,
+			want: []string{"push", "-u", "fork", "alice/twig"},
+		},
+		{
+			name: "pushRemote with upstream elsewhere",
+			outputs: map[string]string{
+				"rev-parse --abbrev-ref --symbolic-full-name @{u}": "upstream/twig\n",
+				"rev-parse --abbrev-ref HEAD":                      "alice/twig\n",
+				"config --get mob-consensus.pushRemote":            "origin\n",
+				"remote":                                           "origin\nupstream\n",
+			},
+			call: pushArgs,
+			want: []string{"push", "origin", "alice/twig"},
+		},
+		{
+			name: "pushRemote with upstream on push remote",
+			outputs: map[string]string{
+				"rev-parse --abbrev-ref --symbolic-full-name @{u}": "origin/alice/twig\n",
+				"rev-parse --abbrev-ref HEAD":                      "alice/twig\n",
+				"config --get mob-consensus.pushRemote":            "origin\n",
+				"remote":                                           "origin\nupstream\n",
+			},
+			call: pushArgs,
+			want: []string{"push"},
+		},
+		{
+			name: "pushRemote not configured as a remote",
+			outputs: map[string]string{
+				"config --get mob-consensus.pushRemote": "fork\n",
+				"remote":                                "origin\n",
+			},
+			call:    pushArgs,
+			wantErr: "mob-consensus.pushRemote names remote \"fork\", which is not configured",
+		},
+		{
+			name: "sole remote",
+			outputs: map[string]string{
+				"rev-parse --abbrev-ref HEAD": "alice/twig\n",
+				"remote":                      "origin\n",
+			},
+			call: pushArgs,
+			want: []string{"push", "-u", "origin", "alice/twig"},
+		},
+		{
+			name: "ambiguous",
+			outputs: map[string]string{
+				"rev-parse --abbrev-ref HEAD": "alice/twig\n",
+				"remote":                      "origin\njj\n",
+			},
+			call:    pushArgs,
+			wantErr: "multiple remotes exist: jj, origin",
+		},
+		{
+			name:    "detached",
+			outputs: map[string]string{"rev-parse --abbrev-ref HEAD": "HEAD\n"},
+			call:    pushArgs,
+			wantErr: "detached HEAD",
+		},
+	})
+}
+
+// TestRunnerToolsFake covers tool precedence and the availability checks.
+func TestRunnerToolsFake(t *testing.T) {
+	t.Parallel()
+
+	const help = "'git difftool --tool=<tool>' may be set to one of the following:\n" +
+		"\t\tvimdiff              Use Vim\n" +
+		"\nThe following tools are valid, but not currently available:\n" +
+		"\t\tmeld                 Use Meld\n"
+	outputs := map[string]string{
+		"config --get merge.tool":             "meld\n",
+		"config --get mob-consensus.difftool": "vimdiff\n",
+		"config --get mob-consensus.editor":   "true\n",
+		"config --get mergetool.custom.cmd":   "mob-consensus-no-such-tool $MERGED\n",
+		"mergetool --tool-help":               help,
+		"difftool --tool-help":                help,
+		"-c core.editor=true var GIT_EDITOR":  "true\n",
+	}
+	// checkMergeTool resolves the tools with o, then checks the merge tool.
+	checkMergeTool := func(o ToolOverrides) func(context.Context, Runner) (any, error) {
+		return func(ctx context.Context, r Runner) (any, error) {
+			return nil, r.CheckMergeTool(ctx, r.ResolveTools(ctx, o))
+		}
+	}
+	runFakeCases(t, []fakeCase{
+		{
+			name:    "config precedence",
+			outputs: outputs,
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.ResolveTools(ctx, ToolOverrides{}), nil
+			},
+			want: Tools{MergeTool: "meld", MergeToolSource: "merge.tool", DiffTool: "vimdiff", DiffToolSource: ConfigDiffTool, Editor: "true"},
+		},
+		{
+			name:    "flags win",
+			outputs: outputs,
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.ResolveTools(ctx, ToolOverrides{MergeTool: "vimdiff", DiffTool: "meld", NoDiffTool: true}), nil
+			},
+			want: Tools{MergeTool: "vimdiff", MergeToolSource: "--mergetool", DiffTool: "meld", DiffToolSource: "--difftool", NoDiffTool: true, Editor: "true"},
+		},
+		{
+			name:    "GitArgs passes the editor",
+			outputs: outputs,
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return r.ResolveTools(ctx, ToolOverrides{}).GitArgs("commit", "-e"), nil
+			},
+			want: []string{"-c", "core.editor=true", "commit", "-e"},
+		},
+		{
+			name:    "CheckTools leaves out the merge tool",
+			outputs: outputs,
+			call: func(ctx context.Context, r Runner) (any, error) {
+				return nil, r.CheckTools(ctx, r.ResolveTools(ctx, ToolOverrides{}))
+			},
+			want: nil,
+		},
+		{
+			name:    "CheckMergeTool unavailable tool",
+			outputs: outputs,
+			call:    checkMergeTool(ToolOverrides{}),
+			wantErr: `mergetool "meld" (from merge.tool) is not available (hint: install it, pass --mergetool <tool>, or set: git config --local mob-consensus.mergetool <tool>; available: vimdiff)`,
+		},
+		{
+			name:    "CheckMergeTool available tool",
+			outputs: outputs,
+			call:    checkMergeTool(ToolOverrides{MergeTool: "vimdiff"}),
+			want:    nil,
+		},
+		{
+			name:    "CheckMergeTool missing custom command",
+			outputs: outputs,
+			call:    checkMergeTool(ToolOverrides{MergeTool: "custom"}),
+			wantErr: `its command "mob-consensus-no-such-tool $MERGED" was not found on PATH`,
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package consensus
+
+import "strings"
+
+// MergeRef returns the ref to pass to `git merge` for the branch: the name
+// as listed by `git branch -a`, without the "remotes/" prefix.
+func (s BranchStatus) MergeRef() string {
+	return strings.TrimPrefix(s.Branch, "remotes/")
+}
+
+// NeedsMerge reports whether the branch has changes the current branch lacks
+// (StateAhead or StateDiverged).
+func (s BranchStatus) NeedsMerge() bool {
+	state := s.State()
+	return state == StateAhead || state == StateDiverged
+}
+
+// SyncFilter selects the peers `sync` merges. Entries match a branch's
+// <user> label, its `git branch -a` name, or its MergeRef. An empty Only
+// allows every peer; Skip wins over Only.
+type SyncFilter struct {
+	Only []string
+	Skip []string
+}
+
+// Allows reports whether the filter lets s be merged.
+func (f SyncFilter) Allows(s BranchStatus) bool {
+	matches := func(list []string) bool {
+		for _, name := range list {
+			if name == s.User || name == s.Branch || name == s.MergeRef() {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(f.Skip) {
+		return false
+	}
+	return len(f.Only) == 0 || matches(f.Only)
+}
+
+// NextSyncTarget returns the first branch in d that needs a merge, is allowed
+// by f, and isn't in tried (keyed by Branch). ok is false when none is left.
+//
+// Callers re-run Discover after each merge: merging one peer often brings a
+// copy of it on another remote up to date as well.
+func NextSyncTarget(d Discovery, f SyncFilter, tried map[string]bool) (BranchStatus, bool) {
+	for _, b := range d.Branches {
+		if b.NeedsMerge() && f.Allows(b) && !tried[b.Branch] {
+			return b, true
+		}
+	}
+	return BranchStatus{}, false
+}
+
+// MergeTargets returns the MergeRef of every branch in d that needs a merge
+// and is allowed by f, in order. A branch pointing at a commit already listed
+// (ex: a peer's local and remote-tracking copies) is left out.
+func (d Discovery) MergeTargets(f SyncFilter) []string {
+	var targets []string
+	seen := map[string]bool{}
+	for _, b := range d.Branches {
+		if !b.NeedsMerge() || !f.Allows(b) || seen[b.Tip] {
+			continue
+		}
+		seen[b.Tip] = true
+		targets = append(targets, b.MergeRef())
+	}
+	return targets
+}
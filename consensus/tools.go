@@ -0,0 +1,220 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Git config keys that pick the interactive tools used by `merge`. They take
+// precedence over git's own merge.tool/diff.tool/core.editor.
+const (
+	ConfigMergeTool = "mob-consensus.mergetool"
+	ConfigDiffTool  = "mob-consensus.difftool"
+	ConfigEditor    = "mob-consensus.editor"
+)
+
+// DefaultTool is used when neither a flag nor any config names a tool.
+const DefaultTool = "vimdiff"
+
+// ToolOverrides are per-invocation choices (CLI flags); empty means "use
+// config".
+type ToolOverrides struct {
+	MergeTool  string
+	DiffTool   string
+	NoDiffTool bool
+}
+
+// Tools are the resolved interactive tools, each with the flag or config key
+// it came from so errors can say how to change it.
+type Tools struct {
+	MergeTool       string
+	MergeToolSource string
+	DiffTool        string
+	DiffToolSource  string
+	// NoDiffTool skips the post-merge difftool review.
+	NoDiffTool bool
+	// Editor is the ConfigEditor value, or "" to let git pick (GIT_EDITOR,
+	// core.editor, VISUAL, EDITOR).
+	Editor string
+}
+
+// ResolveTools picks the merge and diff tools and the commit editor.
+//
+// Precedence: --mergetool, ConfigMergeTool, merge.tool, DefaultTool; and
+// --difftool, ConfigDiffTool, diff.tool, merge.tool (as git difftool does),
+// DefaultTool.
+func (r Runner) ResolveTools(ctx context.Context, o ToolOverrides) Tools {
+	pick := func(flag, flagName string, keys ...string) (string, string) {
+		if v := strings.TrimSpace(flag); v != "" {
+			return v, flagName
+		}
+		for _, key := range keys {
+			if v, _ := r.outputTrimmed(ctx, "config", "--get", key); v != "" {
+				return v, key
+			}
+		}
+		return DefaultTool, "default"
+	}
+	t := Tools{NoDiffTool: o.NoDiffTool}
+	t.MergeTool, t.MergeToolSource = pick(o.MergeTool, "--mergetool", ConfigMergeTool, "merge.tool")
+	t.DiffTool, t.DiffToolSource = pick(o.DiffTool, "--difftool", ConfigDiffTool, "diff.tool", "merge.tool")
+	t.Editor, _ = r.outputTrimmed(ctx, "config", "--get", ConfigEditor)
+	return t
+}
+
+// GitArgs prefixes args with `-c core.editor=...` when an editor is
+// configured, so `git commit` opens it instead of git's default. As with
+// core.editor, a GIT_EDITOR environment variable still takes precedence.
+func (t Tools) GitArgs(args ...string) []string {
+	if t.Editor == "" {
+		return args
+	}
+	return append([]string{"-c", "core.editor=" + t.Editor}, args...)
+}
+
+// ToolUnavailableError reports a merge/diff tool or editor that can't run.
+type ToolUnavailableError struct {
+	// Kind is "mergetool", "difftool", or "editor".
+	Kind   string
+	Tool   string
+	Source string
+	// Command is the configured <kind>.<tool>.cmd whose program is missing.
+	Command string
+	// Available lists tools git reports as usable (mergetool/difftool only).
+	Available []string
+}
+
+// Error implements the error interface.
+func (e ToolUnavailableError) Error() string {
+	var hint string
+	switch e.Kind {
+	case "editor":
+		hint = fmt.Sprintf("install it, or set: git config --local %s <command>", ConfigEditor)
+	default:
+		key := ConfigMergeTool
+		if e.Kind == "difftool" {
+			key = ConfigDiffTool
+		}
+		hint = fmt.Sprintf("install it, pass --%s <tool>, or set: git config --local %s <tool>", e.Kind, key)
+		if e.Command != "" {
+			hint = fmt.Sprintf("its command %q was not found on PATH; ", e.Command) + hint
+		}
+		if e.Kind == "difftool" {
+			hint += "; or skip the review with --no-difftool"
+		}
+		if len(e.Available) > 0 {
+			hint += "; available: " + strings.Join(e.Available, ", ")
+		}
+	}
+	return fmt.Sprintf("mob-consensus: %s %q (from %s) is not available (hint: %s)", e.Kind, e.Tool, e.Source, hint)
+}
+
+// CheckTools verifies that the diff tool (unless skipped) and the commit
+// editor can run, so a merge never stops halfway for a missing tool. Every
+// merge uses them; the merge tool is only needed for conflicts, so it is
+// checked separately (see CheckMergeTool).
+//
+// A tool with a <kind>.<tool>.cmd (difftool also falls back to
+// mergetool.<tool>.cmd, as git does) needs that command's program on PATH.
+// Other tools must be listed as available by `git <kind> --tool-help`, which
+// applies git's own rules for built-in tools.
+func (r Runner) CheckTools(ctx context.Context, t Tools) error {
+	if !t.NoDiffTool {
+		if err := r.checkTool(ctx, "difftool", t.DiffTool, t.DiffToolSource); err != nil {
+			return err
+		}
+	}
+
+	editor, err := r.outputTrimmed(ctx, t.GitArgs("var", "GIT_EDITOR")...)
+	if err != nil {
+		return err
+	}
+	source := "git's default editor"
+	if t.Editor != "" {
+		source = ConfigEditor
+	}
+	if !commandExists(editor) {
+		return ToolUnavailableError{Kind: "editor", Tool: editor, Source: source}
+	}
+	return nil
+}
+
+// CheckMergeTool verifies that the merge tool can run (see CheckTools). Call
+// it before a merge that is predicted to conflict, and before running the
+// merge tool.
+func (r Runner) CheckMergeTool(ctx context.Context, t Tools) error {
+	return r.checkTool(ctx, "mergetool", t.MergeTool, t.MergeToolSource)
+}
+
+// checkTool checks one merge/diff tool.
+func (r Runner) checkTool(ctx context.Context, kind, tool, source string) error {
+	keys := []string{kind + "." + tool + ".cmd"}
+	if kind == "difftool" {
+		keys = append(keys, "mergetool."+tool+".cmd")
+	}
+	for _, key := range keys {
+		if cmd, _ := r.outputTrimmed(ctx, "config", "--get", key); cmd != "" {
+			if commandExists(cmd) {
+				return nil
+			}
+			return ToolUnavailableError{Kind: kind, Tool: tool, Source: source, Command: cmd}
+		}
+	}
+
+	help, err := r.output(ctx, kind, "--tool-help")
+	if err != nil {
+		return err
+	}
+	available := ParseToolHelp(help)
+	for _, name := range available {
+		if name == tool {
+			return nil
+		}
+	}
+	return ToolUnavailableError{Kind: kind, Tool: tool, Source: source, Available: available}
+}
+
+// ParseToolHelp extracts the usable tools from `git mergetool --tool-help` (or
+// difftool) output: the entries listed before "The following tools are valid,
+// but not currently available", including the "user-defined:" subsection
+// (whose entries look like "<tool>.cmd <command>").
+func ParseToolHelp(help string) []string {
+	var available []string
+	for _, line := range strings.Split(help, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "The following tools are valid"),
+			strings.HasPrefix(trimmed, "No suitable tool"):
+			return available
+		case trimmed == "" || trimmed == "user-defined:" || !strings.HasPrefix(line, "\t"):
+			continue
+		}
+		available = append(available, strings.TrimSuffix(strings.Fields(trimmed)[0], ".cmd"))
+	}
+	return available
+}
+
+// commandExists reports whether the program that starts the shell command
+// line cmd can be found. Command lines that start with shell syntax (quotes,
+// variables, redirections) can't be checked without running them and are
+// assumed to work.
+func commandExists(cmd string) bool {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return false
+	}
+	prog := fields[0]
+	if strings.ContainsAny(prog, "\"'$`\\(){}<>|&;=") {
+		return true
+	}
+	if filepath.IsAbs(prog) {
+		_, err := os.Stat(prog)
+		return err == nil
+	}
+	_, err := exec.LookPath(prog)
+	return err == nil
+}
@@ -0,0 +1,176 @@
+package consensus
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TwigBranch is one personal "<user>/<twig>" branch, local or
+// remote-tracking.
+type TwigBranch struct {
+	// Branch is the name as `git branch -a` lists it (ex: "bob/twig" or
+	// "remotes/origin/bob/twig").
+	Branch string
+	// Remote is the remote name for remote-tracking branches, else "".
+	Remote string
+	// User is the "<user>" prefix in front of "/<twig>".
+	User string
+	// Tip is the commit SHA the branch points at.
+	Tip string
+}
+
+// Name returns the branch name on its own repo (ex: "bob/twig" for
+// "remotes/origin/bob/twig").
+func (b TwigBranch) Name() string {
+	if b.Remote == "" {
+		return b.Branch
+	}
+	return strings.TrimPrefix(b.Branch, "remotes/"+b.Remote+"/")
+}
+
+// Ref returns the full ref name (ex: "refs/remotes/origin/bob/twig").
+func (b TwigBranch) Ref() string {
+	if b.Remote == "" {
+		return "refs/heads/" + b.Branch
+	}
+	return "refs/" + b.Branch
+}
+
+// TwigBranches lists the personal branches of twig, local and
+// remote-tracking, in `git branch -a` order. Copies of the shared twig itself
+// (ex: "remotes/origin/twig") aren't personal branches and are skipped.
+func (r Runner) TwigBranches(ctx context.Context, twig string) ([]TwigBranch, error) {
+	n, err := r.Naming(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refs, _, err := r.relatedRefs(ctx, n, twig, false)
+	if err != nil {
+		return nil, err
+	}
+	var out []TwigBranch
+	for _, ref := range refs {
+		b := TwigBranch{Branch: ref.Branch, Tip: ref.Tip}
+		b.Remote, b.User = n.SplitBranch(ref.Branch, twig)
+		if b.Remote != "" && b.Name() == twig {
+			continue
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// TwigSummary describes one twig as listed by Twigs.
+type TwigSummary struct {
+	Twig string
+	// Users lists the participants: the distinct "<user>" prefixes of the
+	// personal branches, sorted.
+	Users []string
+	// Branches are the personal branches, in `git branch -a` order.
+	Branches []TwigBranch
+	// SharedLocal and SharedRemotes tell where the shared twig branch itself
+	// exists: as a local branch, and on which remotes.
+	SharedLocal   bool
+	SharedRemotes []string
+	// LastActivity is the newest committer date among the twig's branches
+	// (personal and shared); LastAuthor is that commit's author.
+	LastActivity time.Time
+	LastAuthor   string
+}
+
+// Twigs groups every personal branch, local and remote-tracking, by twig
+// (see Naming), most recently active first. A twig is listed once someone
+// has a personal branch on it; a branch named just "<twig>" (locally or on a
+// remote) is its shared twig.
+func (r Runner) Twigs(ctx context.Context) ([]TwigSummary, error) {
+	n, err := r.Naming(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refs, _, err := r.branchRefs(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// A twig may itself look like a personal branch (ex: "feature/login"
+	// under "{user}/{twig}"), so names that are some twig are shared twigs
+	// first.
+	twigNames := map[string]bool{}
+	for _, ref := range refs {
+		_, name := splitRemote(ref.Branch)
+		if _, twig, ok := n.Parse(name); ok {
+			twigNames[twig] = true
+		}
+	}
+
+	byTwig := map[string]*TwigSummary{}
+	var order []string
+	type shared struct {
+		local   bool
+		remotes []string
+		refs    []relatedRef
+	}
+	sharedBy := map[string]*shared{}
+	for _, ref := range refs {
+		remote, name := splitRemote(ref.Branch)
+		if twigNames[name] {
+			sh := sharedBy[name]
+			if sh == nil {
+				sh = &shared{}
+				sharedBy[name] = sh
+			}
+			if remote == "" {
+				sh.local = true
+			} else {
+				sh.remotes = append(sh.remotes, remote)
+			}
+			sh.refs = append(sh.refs, ref)
+			continue
+		}
+		user, twig, ok := n.Parse(name)
+		if !ok {
+			continue
+		}
+		t := byTwig[twig]
+		if t == nil {
+			t = &TwigSummary{Twig: twig}
+			byTwig[twig] = t
+			order = append(order, twig)
+		}
+		t.Branches = append(t.Branches, TwigBranch{Branch: ref.Branch, Remote: remote, User: user, Tip: ref.Tip})
+		t.touch(ref)
+	}
+
+	out := make([]TwigSummary, 0, len(order))
+	for _, twig := range order {
+		t := byTwig[twig]
+		seen := map[string]bool{}
+		for _, b := range t.Branches {
+			if !seen[b.User] {
+				seen[b.User] = true
+				t.Users = append(t.Users, b.User)
+			}
+		}
+		sort.Strings(t.Users)
+		if sh := sharedBy[twig]; sh != nil {
+			t.SharedLocal, t.SharedRemotes = sh.local, sh.remotes
+			for _, ref := range sh.refs {
+				t.touch(ref)
+			}
+		}
+		out = append(out, *t)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].LastActivity.After(out[j].LastActivity)
+	})
+	return out, nil
+}
+
+// touch records ref's tip commit as the twig's last activity if it is newer.
+func (t *TwigSummary) touch(ref relatedRef) {
+	if ref.Time.After(t.LastActivity) {
+		t.LastActivity, t.LastAuthor = ref.Time, ref.Author
+	}
+}
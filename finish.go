@@ -0,0 +1,270 @@
+package main
+
+// `mob-consensus finish`: land the consensus at the end of a session.
+//
+// finish refuses to run until every related branch is synced with the
+// current branch (the comparison `status` prints), then brings the shared
+// twig up to the consensus and pushes it. With --base it checks that the
+// twig would merge cleanly into the base branch and suggests a pull
+// request; with --merge it merges and pushes the base itself. Every git step
+// goes through runGitPlan, so --plan, --dry-run, and --yes behave as in
+// start/join, and re-running finish skips the steps that are already done.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/stevegt/mob-consensus/consensus"
+)
+
+// runFinish implements `mob-consensus finish`. currentBranch is the user's
+// personal branch; its tip is the consensus that lands on the twig.
+func runFinish(ctx context.Context, g consensus.Git, opts options, user, currentBranch string, stdout, stderr io.Writer) error {
+	if opts.plan || opts.dryRun {
+		dirty, err := isDirty(ctx, g)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return usageError{Err: errors.New("mob-consensus: working tree is dirty (clean it before using --plan/--dry-run)")}
+		}
+	} else {
+		execOpts := opts
+		execOpts.noPush = true
+		if err := ensureClean(ctx, g, execOpts, true, stdout); err != nil {
+			return err
+		}
+	}
+
+	repo := consensus.Runner{Git: g}
+	naming, err := repo.Naming(ctx)
+	if err != nil {
+		return err
+	}
+	twig, err := repo.Twig(ctx, naming, currentBranch)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSpace(opts.base)
+	if opts.mergeBase {
+		exists, err := localBranchExists(ctx, g, base)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return usageError{Err: fmt.Errorf("mob-consensus: --merge needs --base to name a local branch; %q isn't one (hint: git branch %s <remote>/%s)", base, base, base)}
+		}
+	} else if base != "" {
+		if _, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", "--quiet", base+"^{commit}"); err != nil {
+			return usageError{Err: fmt.Errorf("mob-consensus: base %q is not a commit", base)}
+		}
+	}
+
+	remote, err := resolveRemote(ctx, g, cmdFinish, opts, stderr)
+	if err != nil {
+		return usageError{Err: err}
+	}
+	twigRemote, err := resolveTwigRemote(ctx, g, remote)
+	if err != nil {
+		return err
+	}
+
+	d, err := repo.Discover(ctx, currentBranch)
+	if err != nil {
+		return err
+	}
+	var unsynced []string
+	for _, b := range d.Branches {
+		if isTwigRef(b, twig) {
+			continue
+		}
+		if state := b.State(); state != consensus.StateSynced {
+			unsynced = append(unsynced, fmt.Sprintf("%s (%s)", b.Branch, state))
+		}
+	}
+	if len(unsynced) > 0 {
+		return fmt.Errorf("mob-consensus: no consensus yet; not synced with %s: %s (hint: run `mob-consensus sync` and push, have your peers do the same, then check `mob-consensus status`)", currentBranch, strings.Join(unsynced, ", "))
+	}
+
+	// twigSource is the ref the twig step checks out: the local twig, or a
+	// remote-tracking copy to create it from.
+	twigSource := func(ctx context.Context) (string, error) {
+		exists, err := localBranchExists(ctx, g, twig)
+		if err != nil || exists {
+			return "refs/heads/" + twig, err
+		}
+		for _, r := range []string{twigRemote, remote} {
+			exists, err := remoteTrackingBranchExists(ctx, g, r, twig)
+			if err != nil || exists {
+				return "refs/remotes/" + r + "/" + twig, err
+			}
+		}
+		return "", fmt.Errorf("mob-consensus: shared twig %q not found locally or on %s (hint: mob-consensus start --twig %s)", twig, twigRemote, twig)
+	}
+	// contains returns a Done check: satisfied when branch already holds
+	// the consensus.
+	contains := func(branch string) func(ctx context.Context) (string, error) {
+		return func(ctx context.Context) (string, error) {
+			exists, err := localBranchExists(ctx, g, branch)
+			if err != nil || !exists {
+				return "", err
+			}
+			ok, err := repo.IsAncestor(ctx, currentBranch, "refs/heads/"+branch)
+			if err != nil || !ok {
+				return "", err
+			}
+			return fmt.Sprintf("%s already contains %s", branch, currentBranch), nil
+		}
+	}
+	// pushed returns a Done check for pushing branch: satisfied once it
+	// holds the consensus and its remote copy is up to date.
+	pushed := func(branch string) func(ctx context.Context) (string, error) {
+		return func(ctx context.Context) (string, error) {
+			if reason, err := contains(branch)(ctx); err != nil || reason == "" {
+				return "", err
+			}
+			return pushedDone(g, remote, branch)(ctx)
+		}
+	}
+
+	title := fmt.Sprintf("mob-consensus finish (twig=%s, %s, user=%s)", twig, remoteLabel(remote, twigRemote), user)
+	if base != "" {
+		title = fmt.Sprintf("mob-consensus finish (twig=%s, base=%s, %s, user=%s)", twig, base, remoteLabel(remote, twigRemote), user)
+	}
+	steps := []gitPlanStep{
+		{
+			Explain: fmt.Sprintf("Switch to shared twig %q", twig),
+			Args: func(ctx context.Context) ([]string, error) {
+				src, err := twigSource(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if src == "refs/heads/"+twig {
+					return []string{"checkout", twig}, nil
+				}
+				return []string{"checkout", "-b", twig, "--track", strings.TrimPrefix(src, "refs/remotes/")}, nil
+			},
+			Done: contains(twig),
+		},
+		{
+			Explain: fmt.Sprintf("Bring the consensus from %q into %q (fast-forward when possible)", currentBranch, twig),
+			Args: func(ctx context.Context) ([]string, error) {
+				src, err := twigSource(ctx)
+				if err != nil {
+					return nil, err
+				}
+				ff, err := repo.IsAncestor(ctx, src, currentBranch)
+				if err != nil {
+					return nil, err
+				}
+				if ff {
+					return []string{"merge", "--ff-only", currentBranch}, nil
+				}
+				// The twig moved on since the consensus was built; refuse a
+				// merge that would stop with conflicts on the twig.
+				if p, err := repo.PredictMergeInto(ctx, src, currentBranch); err == nil && !p.Clean() {
+					return nil, fmt.Errorf("mob-consensus: %s has changes that conflict with %s in %s (%s) (hint: git merge %s into %s, resolve, push, then finish again)",
+						strings.TrimPrefix(strings.TrimPrefix(src, "refs/heads/"), "refs/remotes/"), currentBranch, countNoun(len(p.Conflicts), "file"), strings.Join(p.Conflicts, ", "), twig, currentBranch)
+				}
+				return []string{"merge", "--no-ff", "--no-edit", currentBranch}, nil
+			},
+			Done: contains(twig),
+		},
+		{
+			// The twig is pushed to the push remote like every other
+			// branch: mob-consensus.twigRemote is fetch-only (in fork
+			// workflows it is often upstream, which we can't push to).
+			Explain: fmt.Sprintf("Push shared twig %q", twig),
+			Args: func(ctx context.Context) ([]string, error) {
+				return []string{"push", "-u", remote, twig}, nil
+			},
+			Done: pushed(twig),
+		},
+	}
+	if opts.mergeBase {
+		steps = append(steps, []gitPlanStep{
+			{
+				Explain: fmt.Sprintf("Switch to base branch %q", base),
+				Args: func(ctx context.Context) ([]string, error) {
+					return []string{"checkout", base}, nil
+				},
+				Done: contains(base),
+			},
+			{
+				Explain: fmt.Sprintf("Merge shared twig %q into %q", twig, base),
+				Args: func(ctx context.Context) ([]string, error) {
+					// Refuse a merge that would stop with conflicts on the
+					// base. Until the twig holds the consensus, the
+					// consensus stands in for it.
+					landed := twig
+					if reason, err := contains(twig)(ctx); err != nil || reason == "" {
+						landed = currentBranch
+					}
+					if p, err := repo.PredictMergeInto(ctx, "refs/heads/"+base, landed); err == nil && !p.Clean() {
+						return nil, fmt.Errorf("mob-consensus: %s has changes that conflict with %s in %s (%s) (hint: git merge %s into %s, resolve, push, then finish --merge again)",
+							base, landed, countNoun(len(p.Conflicts), "file"), strings.Join(p.Conflicts, ", "), base, currentBranch)
+					}
+					return []string{"merge", "--no-ff", "--no-edit", twig}, nil
+				},
+				Done: contains(base),
+			},
+			{
+				Explain: fmt.Sprintf("Push base branch %q", base),
+				Args: func(ctx context.Context) ([]string, error) {
+					return []string{"push", remote, base}, nil
+				},
+				Done: pushed(base),
+			},
+		}...)
+	}
+	steps = append(steps, gitPlanStep{
+		Explain: fmt.Sprintf("Switch back to your personal branch %q", currentBranch),
+		Args: func(ctx context.Context) ([]string, error) {
+			return []string{"checkout", currentBranch}, nil
+		},
+		Done: onBranchDone(g, currentBranch),
+	})
+
+	if err := runGitPlan(ctx, g, opts, title, steps, stdout, stderr); err != nil {
+		// A merge that stopped anyway (ex: the prediction needs git 2.38)
+		// is undone, so the twig isn't left half merged.
+		if inProgress, _ := mergeInProgress(ctx, g); inProgress {
+			on, _ := gitOutputTrimmed(ctx, g, "rev-parse", "--abbrev-ref", "HEAD")
+			if abortErr := g.Run(ctx, "merge", "--abort"); abortErr == nil {
+				return fmt.Errorf("%w (aborted the merge on %s; hint: git checkout %s, merge %s into it, resolve, then finish again)", err, on, currentBranch, on)
+			}
+		}
+		return err
+	}
+	if base == "" || opts.mergeBase || opts.dryRun {
+		return nil
+	}
+
+	// Prepare the base: a trial merge shows what a pull request would do.
+	// That is the twig once it holds the consensus; under --plan it doesn't
+	// yet, so the consensus itself stands in for it.
+	fmt.Fprintln(stdout)
+	landed := twig
+	if reason, err := contains(twig)(ctx); err != nil || reason == "" {
+		landed = currentBranch
+	}
+	if p, err := repo.PredictMergeInto(ctx, base, landed); err == nil {
+		if p.Clean() {
+			fmt.Fprintf(stdout, "%s merges cleanly into %s.\n", landed, base)
+		} else {
+			fmt.Fprintf(stdout, "%s would conflict with %s in %s (%s); merge %s into %s and finish again to resolve them first.\n",
+				landed, base, countNoun(len(p.Conflicts), "file"), strings.Join(p.Conflicts, ", "), base, currentBranch)
+		}
+	}
+	fmt.Fprintf(stdout, "Next: open a pull request from %s/%s into %s (or re-run with --merge to merge it yourself).\n", remote, twig, base)
+	return nil
+}
+
+// isTwigRef reports whether b is a copy of the shared twig itself (ex:
+// "remotes/origin/feature-x") rather than someone's <user>/<twig> branch.
+func isTwigRef(b consensus.BranchStatus, twig string) bool {
+	return b.Remote != "" && b.Branch == "remotes/"+b.Remote+"/"+twig
+}
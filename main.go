@@ -2,29 +2,42 @@
 //
 // The tool assumes a convention where each collaborator works on a personal
 // branch named "<user>/<twig>", where:
-//   - <user> is derived from repo-local `git config user.email` (left of '@')
-//   - <twig> is a shared suffix used to group related branches (ex: "feature-x")
+//   - <user> is derived from repo-local `git config user.email` (left of '@'),
+//     unless mob-consensus.user or the .mob-consensus.toml [labels] table
+//     sets it (see consensus.Runner.UserLabel)
+//   - <twig> is a shared name used to group related branches (ex: "feature-x"
+//     or "feature/login")
+//
+// The mob-consensus.branchTemplate git config key changes the layout (ex:
+// "mob/{twig}/{user}"); see consensus.Naming.
 //
 // This Go implementation intentionally shells out to `git` for all repository
-// operations. All `git` commands run in the current working directory, so
-// callers/tests must `chdir` into the target repo before invoking the CLI.
+// operations. Every git command goes through a consensus.Git backend that is
+// threaded from main() down to each helper; the CLI uses consensus.ExecGit in
+// the current working directory, while tests pass a backend bound to their
+// temp repo (no chdir required).
+//
+// Non-interactive logic (twig/user derivation, discovery, merge target
+// resolution, merge messages, push selection) lives in the consensus package;
+// this package renders its results and owns prompts and interactive tools.
 package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
+
+	"github.com/stevegt/mob-consensus/consensus"
 )
 
 // usageTemplate is rendered for `mob-consensus -h` and for usage errors.
@@ -41,6 +54,13 @@ const (
 	cmdInit  command = "init"
 	cmdStart command = "start"
 	cmdJoin  command = "join"
+
+	cmdClaim   command = "claim"
+	cmdUnclaim command = "unclaim"
+	cmdClaims  command = "claims"
+
+	cmdFinish      command = "finish"
+	cmdTwigArchive command = "twig archive"
 )
 
 // options holds parsed flags and arguments. It is shared across commands so
@@ -56,8 +76,11 @@ type options struct {
 	// before continuing. When true, and noPush is false, mob-consensus also
 	// pushes the auto-commit via smartPush.
 	commitDirty bool
-	// otherBranch is the merge target passed to `mob-consensus merge`.
+	// otherBranch is the merge target passed to `mob-consensus merge`;
+	// others holds every target when more than one is given (an octopus
+	// merge).
 	otherBranch string
+	others      []string
 
 	// twig is the shared coordination branch name (suffix) such as "feature-x".
 	twig   string
@@ -66,12 +89,66 @@ type options struct {
 	base   string
 	// remote is the selected remote name for onboarding operations.
 	remote string
+	// mergeBase makes `finish` merge the twig into base and push it,
+	// instead of only checking that it would merge cleanly.
+	mergeBase bool
 	// plan prints a structured plan (commands + explanations) and exits.
 	plan   bool
 	// dryRun prints the git commands that would run without executing them.
 	dryRun bool
 	// yes accepts defaults and skips confirmation prompts.
 	yes    bool
+
+	// format selects `status` output: formatText (default), formatJSON, or
+	// formatNDJSON.
+	format string
+	// noFetch skips fetching before status/merge/sync; `status` also
+	// sets it when a fetch failed and mob-consensus.allowOffline let the
+	// command continue.
+	noFetch bool
+	// matrix makes `status` compare every pair of related branches instead
+	// of each branch against the current one.
+	matrix bool
+	// stale marks related branches whose tip is older than this as stale in
+	// `status`; zero disables the check.
+	stale time.Duration
+
+	// item is the work item for claim/unclaim, or the `claims --item` filter.
+	item  string
+	// who overrides the <user> label a claim is recorded under.
+	who   string
+	// steal lets claim/unclaim remove someone else's claim.
+	steal bool
+
+	// mergeTool and diffTool override the tools `merge` launches (see
+	// consensus.ResolveTools); noDiffTool skips the difftool review.
+	mergeTool  string
+	diffTool   string
+	noDiffTool bool
+	// review runs the built-in hunk-by-hunk review instead of difftool;
+	// approve accepts the change set without the interactive loop.
+	review     bool
+	approve    bool
+	// noAssist skips the configured merge assistant for one merge.
+	noAssist   bool
+	// continueMerge resumes, and abortMerge undoes, the journaled merge
+	// (see consensus.MergeJournal).
+	continueMerge bool
+	abortMerge    bool
+	// stopOnConflict makes `merge` stop before mergetool when the merge
+	// conflicts, leaving it journaled for `merge --continue`; deferPush
+	// skips the push because the caller pushes later (both used by sync).
+	stopOnConflict bool
+	deferPush      bool
+
+	// only and skip filter the peers `sync` merges (see
+	// consensus.SyncFilter).
+	only []string
+	skip []string
+
+	// console is where prompts read their answers and write their
+	// questions.
+	console console
 }
 
 // exitFunc exists so tests can stub process exit without terminating the test
@@ -79,15 +156,18 @@ type options struct {
 var exitFunc = os.Exit
 
 // main delegates to mainExit so tests can exercise the CLI logic in-process.
+//
+// The real CLI runs git in the process cwd, connected to the process stdio.
 func main() {
-	exitFunc(mainExit(context.Background(), os.Args[1:], os.Stdout, os.Stderr))
+	g := consensus.ExecGit{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	exitFunc(mainExit(context.Background(), g, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
 
 // mainExit is the top-level entrypoint for CLI execution. It returns an exit
 // code (instead of calling os.Exit) so it can be used by tests.
 //
 // Errors wrapped in usageError cause the help text to be printed.
-func mainExit(ctx context.Context, args []string, stdout, stderr io.Writer) (code int) {
+func mainExit(ctx context.Context, g consensus.Git, args []string, stdin io.Reader, stdout, stderr io.Writer) (code int) {
 	defer func() {
 		if r := recover(); r != nil {
 			printPanic(stderr, r)
@@ -95,11 +175,11 @@ func mainExit(ctx context.Context, args []string, stdout, stderr io.Writer) (cod
 		}
 	}()
 
-	if err := run(ctx, args, stdout, stderr); err != nil {
+	if err := run(ctx, g, args, stdin, stdout, stderr); err != nil {
 		var uerr usageError
 		if errors.As(err, &uerr) {
 			printError(stderr, uerr.Err)
-			_ = printUsage(ctx, stderr)
+			_ = printUsage(ctx, g, stderr)
 			return 1
 		}
 		printError(stderr, err)
@@ -152,51 +232,26 @@ func (e usageError) Unwrap() error {
 	return e.Err
 }
 
-// branchNotFoundError is returned when the user names a merge target that
-// cannot be resolved as a local ref or an unambiguous remote ref.
-type branchNotFoundError struct {
-	Branch  string
-	Remotes []string
-}
-
-// Error implements the error interface with a machine-friendly message.
-func (e branchNotFoundError) Error() string {
-	if len(e.Remotes) == 0 {
-		return fmt.Sprintf("mob-consensus: branch %q not found locally and no remotes configured (hint: git remote -v)", e.Branch)
-	}
-
-	remotes := append([]string(nil), e.Remotes...)
-	sort.Strings(remotes)
-	return fmt.Sprintf(
-		"mob-consensus: branch %q not found locally or on any remote (%s) (hint: git fetch --all; or use an explicit ref like <remote>/%s)",
-		e.Branch,
-		strings.Join(remotes, ", "),
-		e.Branch,
-	)
-}
-
-// Msg returns a friendlier message than Error() and includes a next-step hint.
-func (e branchNotFoundError) Msg() string {
-	return fmt.Sprintf(
-		"mob-consensus: branch %q does not exist.\n\nPick a branch name from the list above (the same list shown by running `mob-consensus status`), then re-run:\n  mob-consensus merge <branch>",
-		e.Branch,
-	)
-}
-
 // usageData is the data model for `usage.tmpl`. Keep this structure stable:
 // tests and scripts depend on the wording and examples in the rendered output.
 type usageData struct {
-	CurrentBranch string
-	Twig          string
-	ExampleTwig   string
+	CurrentBranch  string
+	Twig           string
+	ExampleTwig    string
+	BranchTemplate string
 
 	User       string
 	UserBranch string
 	PeerBranch string
 	PeerRef    string
 
-	DerivedUser      string
-	DerivedUserValid bool
+	// DerivedUser is the <user> label and DerivedUserSource where it came
+	// from (see consensus.Runner.UserLabel); DerivedUserSet is false when
+	// there is none.
+	DerivedUser       string
+	DerivedUserSource string
+	DerivedUserSet    bool
+	DerivedUserValid  bool
 
 	UserName     string
 	UserEmail    string
@@ -211,15 +266,23 @@ type usageData struct {
 
 // printUsage renders usage.tmpl with repo-specific context (current branch,
 // derived <user>, and the available/configured remotes).
-func printUsage(ctx context.Context, w io.Writer) error {
-	currentBranch, err := gitOutputTrimmed(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+func printUsage(ctx context.Context, g consensus.Git, w io.Writer) error {
+	currentBranch, err := gitOutputTrimmed(ctx, g, "rev-parse", "--abbrev-ref", "HEAD")
 	if err != nil {
 		currentBranch = ""
 	}
 
+	// An invalid naming template is reported by the commands; usage falls
+	// back to the default.
+	naming, err := consensus.Runner{Git: g}.Naming(ctx)
+	if err != nil {
+		naming = consensus.DefaultNaming()
+	}
 	twig := "twig"
 	if currentBranch != "" {
-		twig = twigFromBranch(currentBranch)
+		if twig, err = (consensus.Runner{Git: g}).Twig(ctx, naming, currentBranch); err != nil {
+			twig = naming.Twig(currentBranch)
+		}
 	}
 
 	exampleTwig := "feature-x"
@@ -231,32 +294,23 @@ func printUsage(ctx context.Context, w io.Writer) error {
 		}
 	}
 
-	userName, _ := gitOutputTrimmed(ctx, "config", "--get", "user.name")
-	userEmail, _ := gitOutputTrimmed(ctx, "config", "--get", "user.email")
+	userName, _ := gitOutputTrimmed(ctx, g, "config", "--get", "user.name")
+	userEmail, _ := gitOutputTrimmed(ctx, g, "config", "--get", "user.email")
 	userEmailSet := userEmail != ""
 
-	derivedUser := ""
-	derivedUserValid := false
-	if userEmailSet {
-		derivedUser = strings.TrimSpace(userEmail)
-		if at := strings.IndexByte(derivedUser, '@'); at >= 0 {
-			derivedUser = derivedUser[:at]
-		}
-		derivedUser = strings.TrimSpace(derivedUser)
-		if derivedUser != "" {
-			probe := derivedUser + "/probe"
-			if _, err := gitOutput(ctx, "check-ref-format", "--branch", probe); err == nil {
-				derivedUserValid = true
-			}
-		}
+	derivedUser, derivedUserSource, err := consensus.Runner{Git: g}.UserLabel(ctx)
+	derivedUserSet := err == nil || errors.As(err, new(consensus.TeamFileWarning))
+	if !derivedUserSet {
+		derivedUserSource = "user.email"
 	}
+	derivedUserValid := derivedUserSet && consensus.Runner{Git: g}.ValidUser(ctx, derivedUser)
 
 	user := "alice"
 	if derivedUserValid {
 		user = derivedUser
 	}
 
-	remote, remotes, remoteSource := suggestedRemote(ctx)
+	remote, remotes, remoteSource := consensus.Runner{Git: g}.SuggestedRemote(ctx)
 	remoteIsPlaceholder := remote == ""
 	if remoteIsPlaceholder {
 		remote = "<remote>"
@@ -268,17 +322,20 @@ func printUsage(ctx context.Context, w io.Writer) error {
 	}
 
 	data := usageData{
-		CurrentBranch: currentBranch,
-		Twig:          twig,
-		ExampleTwig:   exampleTwig,
+		CurrentBranch:  currentBranch,
+		Twig:           twig,
+		ExampleTwig:    exampleTwig,
+		BranchTemplate: naming.Template,
 
 		User:       user,
-		UserBranch: user + "/" + exampleTwig,
-		PeerBranch: peerUser + "/" + exampleTwig,
-		PeerRef:    remote + "/" + peerUser + "/" + exampleTwig,
+		UserBranch: naming.Branch(user, exampleTwig),
+		PeerBranch: naming.Branch(peerUser, exampleTwig),
+		PeerRef:    remote + "/" + naming.Branch(peerUser, exampleTwig),
 
-		DerivedUser:      derivedUser,
-		DerivedUserValid: derivedUserValid,
+		DerivedUser:       derivedUser,
+		DerivedUserSource: derivedUserSource,
+		DerivedUserSet:    derivedUserSet,
+		DerivedUserValid:  derivedUserValid,
 
 		UserName:     userName,
 		UserEmail:    userEmail,
@@ -298,183 +355,155 @@ func printUsage(ctx context.Context, w io.Writer) error {
 	return tmpl.Execute(w, data)
 }
 
-// suggestedRemote returns a default remote name when the choice is unambiguous,
-// plus the full remote list and a short explanation of the selection.
-//
-// Policy: never assume `origin`. We only select a remote automatically when:
-//   - the current branch has an upstream remote, or
-//   - there is exactly one configured remote.
-func suggestedRemote(ctx context.Context) (string, []string, string) {
-	remotes, err := listRemotes(ctx)
-	if err != nil {
-		return "", nil, ""
-	}
-	if len(remotes) == 0 {
-		return "", nil, ""
-	}
-
-	upstream, err := gitOutputTrimmed(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
-	if err == nil && upstream != "" {
-		if i := strings.IndexByte(upstream, '/'); i > 0 {
-			upstreamRemote := upstream[:i]
-			for _, r := range remotes {
-				if r == upstreamRemote {
-					return upstreamRemote, remotes, "from current branch upstream"
-				}
-			}
-		}
-	}
-
-	if len(remotes) == 1 {
-		return remotes[0], remotes, "only configured remote"
+// fetchRelated runs `git fetch <remote>` for each remote selected by
+// consensus.Runner.FetchRemotes: every remote in mob-consensus.fetchRemotes
+// when configured, otherwise the remote prefix of otherBranch, upstream
+// remote, or only remote. --no-fetch skips it. When
+// mob-consensus.allowOffline is set, a failed fetch becomes a warning on
+// stderr and the command carries on with the local remote-tracking refs; the
+// other remotes are still fetched. It reports whether every selected remote
+// was fetched.
+func fetchRelated(ctx context.Context, g consensus.Git, opts options, otherBranch string, stderr io.Writer) (bool, error) {
+	if opts.noFetch {
+		return false, nil
 	}
-
-	return "", remotes, ""
-}
-
-// listRemotes returns configured remote names (as shown by `git remote`).
-func listRemotes(ctx context.Context) ([]string, error) {
-	remotesOut, err := gitOutputTrimmed(ctx, "remote")
+	repo := consensus.Runner{Git: g}
+	remotes, err := repo.FetchRemotes(ctx, otherBranch)
 	if err != nil {
-		return nil, err
-	}
-	if remotesOut == "" {
-		return nil, nil
+		return false, err
 	}
-
-	var remotes []string
-	for _, line := range strings.Split(remotesOut, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	fetched := true
+	for _, remote := range remotes {
+		err := g.Run(ctx, "fetch", remote)
+		if err == nil {
 			continue
 		}
-		remotes = append(remotes, line)
-	}
-	return remotes, nil
-}
-
-// fetchSuggestedRemote runs `git fetch <remote>` using the same policy as
-// suggestedRemote (upstream remote or only remote), with one extra heuristic:
-// if otherBranch is prefixed with a remote name (ex: "jj/alice/feature-x"), we
-// fetch that remote.
-//
-// Fetch failures are fatal.
-func fetchSuggestedRemote(ctx context.Context, otherBranch string) error {
-	remotes, err := listRemotes(ctx)
-	if err != nil {
-		return err
-	}
-	if len(remotes) == 0 {
-		return errors.New("mob-consensus: no remotes configured (hint: git remote -v)")
-	}
-
-	if otherBranch != "" {
-		if i := strings.IndexByte(otherBranch, '/'); i > 0 {
-			prefix := otherBranch[:i]
-			for _, r := range remotes {
-				if r == prefix {
-					return gitRun(ctx, "fetch", r)
-				}
-			}
-		}
-	}
-
-	upstream, err := gitOutputTrimmed(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
-	if err == nil && upstream != "" {
-		if i := strings.IndexByte(upstream, '/'); i > 0 {
-			upstreamRemote := upstream[:i]
-			for _, r := range remotes {
-				if r == upstreamRemote {
-					return gitRun(ctx, "fetch", upstreamRemote)
-				}
-			}
+		if !repo.AllowOffline(ctx) {
+			return false, fmt.Errorf("mob-consensus: %w (hint: use --no-fetch to work from local refs, or `git config %s true` to continue automatically when fetching fails)", err, consensus.ConfigAllowOffline)
 		}
+		fmt.Fprintf(stderr, "mob-consensus: warning: %v; continuing with the local refs of %s, which may be stale\n", err, remote)
+		fetched = false
 	}
-
-	if len(remotes) == 1 {
-		return gitRun(ctx, "fetch", remotes[0])
-	}
-
-	return fmt.Errorf("mob-consensus: multiple remotes configured (%s); set an upstream or fetch explicitly (e.g., git fetch <remote>)", strings.Join(remotes, ", "))
+	return fetched, nil
 }
 
-// branchUserFromEmail derives the "<user>" branch prefix from repo-local
-// `git config user.email` (left of '@') and validates that it can be used in a
-// branch name.
-func branchUserFromEmail(ctx context.Context) (string, error) {
-	email, err := gitOutputTrimmed(ctx, "config", "--get", "user.email")
-	if err != nil || strings.TrimSpace(email) == "" {
-		return "", errors.New("mob-consensus: git user.email is not set (hint: git config --local user.email alice@example.com)")
-	}
-
-	email = strings.TrimSpace(email)
-	user := email
-	if at := strings.IndexByte(email, '@'); at >= 0 {
-		user = email[:at]
-	}
-	user = strings.TrimSpace(user)
-	if user == "" {
-		return "", fmt.Errorf("mob-consensus: could not derive a username from git user.email=%q", email)
+// checkPushPolicy refuses `git push` args that target a remote other than the
+// configured push remote (see consensus.RemotePolicy). Non-push args and a
+// bare `git push` pass.
+func checkPushPolicy(ctx context.Context, g consensus.Git, args []string) error {
+	remote, ok := consensus.PushTarget(args)
+	if !ok || remote == "" {
+		return nil
 	}
-
-	probe := user + "/probe"
-	if _, err := gitOutput(ctx, "check-ref-format", "--branch", probe); err != nil {
-		return "", fmt.Errorf("mob-consensus: derived username %q (from git user.email=%q) produces an invalid branch name", user, email)
+	policy, err := consensus.Runner{Git: g}.Policy(ctx)
+	if err != nil {
+		return err
 	}
-
-	return user, nil
+	return policy.CheckPush(remote)
 }
 
-// requireUserBranch enforces the "<user>/" personal-branch convention for
-// commands that operate on a collaborator branch. Use -F/--force to override.
-func requireUserBranch(force bool, user, currentBranch string) error {
+// requireUserBranch enforces the personal-branch convention (the naming
+// template, "<user>/<twig>" by default) for commands that operate on a
+// collaborator branch. Use -F/--force to override.
+func requireUserBranch(force bool, naming consensus.Naming, user, currentBranch string) error {
 	if force {
 		return nil
 	}
-	if strings.HasPrefix(currentBranch, user+"/") {
+	if u, _, ok := naming.Parse(currentBranch); ok && u == user {
 		return nil
 	}
-	return fmt.Errorf("mob-consensus: you aren't on a '%s/' branch", user)
+	return fmt.Errorf("mob-consensus: you aren't on a '%s' branch", naming.Branch(user, "<twig>"))
 }
 
 // gitPlanStep is one step in an onboarding plan. Steps are expressed as git
 // subcommand args and can be printed (--plan/--dry-run) or executed.
+//
+// Done, when set, inspects the repo and returns a non-empty reason if the
+// step is already satisfied (for example, the branch is already pushed), so
+// re-running a flow picks up where an earlier run stopped.
 type gitPlanStep struct {
 	Explain string
 	Pre     func(ctx context.Context) error
 	Args    func(ctx context.Context) ([]string, error)
+	Done    func(ctx context.Context) (string, error)
+	// Optional steps may fail without stopping the plan: runGitPlan reports
+	// the error and moves on, and the caller checks what is left afterwards.
+	Optional bool
+}
+
+// done returns the step's Done reason, or "" when it has no Done check.
+func (s gitPlanStep) done(ctx context.Context) (string, error) {
+	if s.Done == nil {
+		return "", nil
+	}
+	return s.Done(ctx)
 }
 
 // runGitPlan prints or executes an ordered list of git commands with
 // explanations. This powers init/start/join so the tool can both:
 //   - show an exact copy/paste plan (`--plan`) and
 //   - execute the same plan interactively (default) or non-interactively (`--yes`).
-func runGitPlan(ctx context.Context, opts options, title string, steps []gitPlanStep, stdout, stderr io.Writer) error {
+//
+// Steps whose Done check passes are skipped: `--plan` marks them "[done]",
+// `--dry-run` leaves them out, and execution reports them without prompting.
+//
+// Push steps are checked against the push-remote policy in every mode, so a
+// plan never shows a push that would be refused.
+func runGitPlan(ctx context.Context, g consensus.Git, opts options, title string, steps []gitPlanStep, stdout, stderr io.Writer) error {
 	if opts.plan {
-		fmt.Fprintln(stdout, title)
-		for i, step := range steps {
-			args, err := step.Args(ctx)
-			if err != nil {
-				return err
-			}
-			fmt.Fprintf(stdout, "  %d) %s\n", i+1, step.Explain)
-			fmt.Fprintf(stdout, "       git %s\n", strings.Join(args, " "))
+		planned, err := planSteps(ctx, g, steps)
+		if err != nil {
+			return err
 		}
+		printPlan(stdout, title, planned)
 		return nil
 	}
 	if opts.dryRun {
 		for _, step := range steps {
+			reason, err := step.done(ctx)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				continue
+			}
 			args, err := step.Args(ctx)
 			if err != nil {
 				return err
 			}
+			if err := checkPushPolicy(ctx, g, args); err != nil {
+				return err
+			}
 			fmt.Fprintf(stdout, "git %s\n", strings.Join(args, " "))
 		}
 		return nil
 	}
 
+	// Refuse policy-blocked pushes before changing anything. Push args don't
+	// depend on earlier steps, so evaluating them up front is safe.
+	for _, step := range steps {
+		args, err := step.Args(ctx)
+		if err != nil {
+			return err
+		}
+		if err := checkPushPolicy(ctx, g, args); err != nil {
+			return err
+		}
+	}
+
 	fmt.Fprintln(stdout, title)
 	for i, step := range steps {
+		// Check each step just before it would run, since earlier steps
+		// change what is already done.
+		reason, err := step.done(ctx)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			fmt.Fprintf(stdout, "\nStep %d/%d: %s\n", i+1, len(steps), step.Explain)
+			fmt.Fprintf(stdout, "  already done: %s\n", reason)
+			continue
+		}
 		if step.Pre != nil {
 			if err := step.Pre(ctx); err != nil {
 				return err
@@ -484,12 +513,15 @@ func runGitPlan(ctx context.Context, opts options, title string, steps []gitPlan
 		if err != nil {
 			return err
 		}
+		if err := checkPushPolicy(ctx, g, args); err != nil {
+			return err
+		}
 
 		fmt.Fprintf(stdout, "\nStep %d/%d: %s\n", i+1, len(steps), step.Explain)
 		fmt.Fprintf(stdout, "  git %s\n", strings.Join(args, " "))
 
 		if !opts.yes {
-			ok, err := confirm(os.Stdin, stderr, "Run this? [y/N]: ")
+			ok, err := confirm(opts.console.in, stderr, "Run this? [y/N]: ")
 			if err != nil {
 				return err
 			}
@@ -498,18 +530,69 @@ func runGitPlan(ctx context.Context, opts options, title string, steps []gitPlan
 			}
 		}
 
-		if err := gitRun(ctx, args...); err != nil {
-			return err
+		if err := g.Run(ctx, args...); err != nil {
+			if !step.Optional {
+				return err
+			}
+			fmt.Fprintf(stdout, "  failed (continuing): %v\n", err)
 		}
 	}
 
 	return nil
 }
 
+// plannedStep is a step as `--plan` shows it. Lines are printed indented
+// under Explain: the git command, or why the step is already done.
+type plannedStep struct {
+	Explain string
+	Done    bool
+	Lines   []string
+}
+
+// planSteps evaluates steps the way `--plan` shows them, refusing pushes the
+// push-remote policy would block.
+func planSteps(ctx context.Context, g consensus.Git, steps []gitPlanStep) ([]plannedStep, error) {
+	var planned []plannedStep
+	for _, step := range steps {
+		reason, err := step.done(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			planned = append(planned, plannedStep{Explain: step.Explain, Done: true, Lines: []string{"(already done: " + reason + ")"}})
+			continue
+		}
+		args, err := step.Args(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPushPolicy(ctx, g, args); err != nil {
+			return nil, err
+		}
+		planned = append(planned, plannedStep{Explain: step.Explain, Lines: []string{"git " + strings.Join(args, " ")}})
+	}
+	return planned, nil
+}
+
+// printPlan prints title and the numbered steps of a `--plan`.
+func printPlan(w io.Writer, title string, steps []plannedStep) {
+	fmt.Fprintln(w, title)
+	for i, step := range steps {
+		if step.Done {
+			fmt.Fprintf(w, "  %d) [done] %s\n", i+1, step.Explain)
+		} else {
+			fmt.Fprintf(w, "  %d) %s\n", i+1, step.Explain)
+		}
+		for _, line := range step.Lines {
+			fmt.Fprintf(w, "       %s\n", line)
+		}
+	}
+}
+
 // isDirty reports whether the working tree has changes (tracked or untracked)
 // as reported by `git status --porcelain`.
-func isDirty(ctx context.Context) (bool, error) {
-	status, err := gitOutputTrimmed(ctx, "status", "--porcelain")
+func isDirty(ctx context.Context, g consensus.Git) (bool, error) {
+	status, err := gitOutputTrimmed(ctx, g, "status", "--porcelain")
 	if err != nil {
 		return false, err
 	}
@@ -521,34 +604,41 @@ func isDirty(ctx context.Context) (bool, error) {
 // Priority:
 //  1) explicit --twig
 //  2) infer from the current branch name
-//     - if on "<user>/<twig>", use that twig
-//     - if on a non-main branch, reuse its basename as the twig
+//     - if on your personal branch, use its twig
+//     - if on a non-main branch, use its twig (see consensus.Naming.Twig)
 //  3) prompt the user (interactive mode only)
 //
 // In non-interactive plan/dry-run/--yes mode, twig must be unambiguous or
 // passed explicitly.
-func resolveTwig(cmd command, opts options, currentBranch, user string, stderr io.Writer) (string, error) {
+func resolveTwig(ctx context.Context, g consensus.Git, cmd command, opts options, naming consensus.Naming, currentBranch, user string, stderr io.Writer) (string, error) {
 	if strings.TrimSpace(opts.twig) != "" {
 		return strings.TrimSpace(opts.twig), nil
 	}
 
-	inferFromCurrent := func() string {
+	inferFromCurrent := func() (string, error) {
 		if currentBranch == "" || currentBranch == "HEAD" {
-			return ""
+			return "", nil
+		}
+		if u, twig, ok := naming.Parse(currentBranch); ok && u == user {
+			return twig, nil
 		}
-		if strings.HasPrefix(currentBranch, user+"/") {
-			return twigFromBranch(currentBranch)
+		twig, err := consensus.Runner{Git: g}.Twig(ctx, naming, currentBranch)
+		if err != nil {
+			return "", err
 		}
-		twig := twigFromBranch(currentBranch)
 		switch twig {
-		case "", "main", "master":
-			return ""
+		case "main", "master":
+			return "", nil
 		default:
-			return twig
+			return twig, nil
 		}
 	}
 
-	if inferred := inferFromCurrent(); inferred != "" {
+	inferred, err := inferFromCurrent()
+	if err != nil {
+		return "", err
+	}
+	if inferred != "" {
 		return inferred, nil
 	}
 
@@ -559,7 +649,7 @@ func resolveTwig(cmd command, opts options, currentBranch, user string, stderr i
 
 	def := "feature-x"
 	fmt.Fprintf(stderr, "Twig name (shared branch): [%s]: ", def)
-	in, err := promptString(os.Stdin)
+	in, err := promptString(opts.console.in)
 	if err != nil {
 		return "", err
 	}
@@ -583,13 +673,14 @@ func resolveBase(opts options, currentBranch string) string {
 //
 // Priority:
 //  1) explicit --remote (must exist)
-//  2) if unambiguous: upstream remote or only remote
-//  3) prompt the user (interactive mode only)
+//  2) the configured push remote (mob-consensus.pushRemote or remote.pushDefault)
+//  3) if unambiguous: upstream remote or only remote
+//  4) prompt the user (interactive mode only)
 //
 // In non-interactive plan/dry-run/--yes mode, the remote must be unambiguous or
 // passed explicitly.
-func resolveRemote(ctx context.Context, cmd command, opts options, stderr io.Writer) (string, error) {
-	remotes, err := listRemotes(ctx)
+func resolveRemote(ctx context.Context, g consensus.Git, cmd command, opts options, stderr io.Writer) (string, error) {
+	remotes, err := consensus.Runner{Git: g}.Remotes(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -608,7 +699,15 @@ func resolveRemote(ctx context.Context, cmd command, opts options, stderr io.Wri
 		return "", fmt.Errorf("mob-consensus: remote %q not found; available remotes: %s", r, strings.Join(remotes, ", "))
 	}
 
-	remote, remotes, _ := suggestedRemote(ctx)
+	policy, err := consensus.Runner{Git: g}.Policy(ctx)
+	if err != nil {
+		return "", err
+	}
+	if policy.PushRemote != "" {
+		return policy.PushRemote, nil
+	}
+
+	remote, remotes, _ := consensus.Runner{Git: g}.SuggestedRemote(ctx)
 	if remote != "" {
 		return remote, nil
 	}
@@ -620,7 +719,7 @@ func resolveRemote(ctx context.Context, cmd command, opts options, stderr io.Wri
 	}
 
 	fmt.Fprintf(stderr, "Pick remote for fetch/push (%s): ", strings.Join(remotes, ", "))
-	in, err := promptString(os.Stdin)
+	in, err := promptString(opts.console.in)
 	if err != nil {
 		return "", err
 	}
@@ -635,111 +734,257 @@ func resolveRemote(ctx context.Context, cmd command, opts options, stderr io.Wri
 
 // validateBranchName validates a *branch name* (not an arbitrary ref) using
 // `git check-ref-format --branch`.
-func validateBranchName(ctx context.Context, label, branch string) error {
+func validateBranchName(ctx context.Context, g consensus.Git, label, branch string) error {
 	if strings.TrimSpace(branch) == "" {
 		return fmt.Errorf("mob-consensus: %s is empty", label)
 	}
-	if _, err := gitOutput(ctx, "check-ref-format", "--branch", branch); err != nil {
+	if _, err := g.Output(ctx, "check-ref-format", "--branch", branch); err != nil {
 		return fmt.Errorf("mob-consensus: invalid %s %q", label, branch)
 	}
 	return nil
 }
 
-// gitRefExists returns whether a fully-qualified ref name exists, using
-// `git show-ref --verify --quiet`.
-func gitRefExists(ctx context.Context, ref string) (bool, error) {
-	cmd := exec.CommandContext(ctx, "git", "show-ref", "--verify", "--quiet", ref)
-	cmd.Stdout = io.Discard
-	cmd.Stderr = io.Discard
-	err := cmd.Run()
-	if err == nil {
-		return true, nil
+// gitRefExists returns whether a fully-qualified ref name exists. It lists
+// matches with `git for-each-ref` (which also matches refs nested below ref)
+// and looks for an exact name, so no exit-status interpretation is needed.
+func gitRefExists(ctx context.Context, g consensus.Git, ref string) (bool, error) {
+	out, err := g.Output(ctx, "for-each-ref", "--format=%(refname)", ref)
+	if err != nil {
+		return false, err
 	}
-
-	var exit *exec.ExitError
-	if errors.As(err, &exit) && exit.ExitCode() == 1 {
-		return false, nil
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == ref {
+			return true, nil
+		}
 	}
-	return false, fmt.Errorf("git show-ref --verify --quiet %s: %w", ref, err)
+	return false, nil
 }
 
 // localBranchExists returns whether refs/heads/<branch> exists.
-func localBranchExists(ctx context.Context, branch string) (bool, error) {
-	return gitRefExists(ctx, "refs/heads/"+branch)
+func localBranchExists(ctx context.Context, g consensus.Git, branch string) (bool, error) {
+	return gitRefExists(ctx, g, "refs/heads/"+branch)
 }
 
 // remoteTrackingBranchExists returns whether refs/remotes/<remote>/<branch>
 // exists locally.
-func remoteTrackingBranchExists(ctx context.Context, remote, branch string) (bool, error) {
-	return gitRefExists(ctx, "refs/remotes/"+remote+"/"+branch)
+func remoteTrackingBranchExists(ctx context.Context, g consensus.Git, remote, branch string) (bool, error) {
+	return gitRefExists(ctx, g, "refs/remotes/"+remote+"/"+branch)
 }
 
-// runInit implements `mob-consensus init`. It fetches remote refs, checks
-// whether the shared twig exists on the remote, then suggests (or runs) either
-// `start` (first member) or `join` (next members).
-//
-// `init` intentionally does not assume a base ref unless it needs to run the
-// `start` path; this keeps `init` usable in detached-HEAD repos when the twig
-// already exists and `join` is sufficient.
-func runInit(ctx context.Context, opts options, user, currentBranch string, stdout, stderr io.Writer) error {
+// branchUpstream returns the short upstream name of a local branch (ex:
+// "origin/feature-x"), or "" when it has none or doesn't exist.
+func branchUpstream(ctx context.Context, g consensus.Git, branch string) (string, error) {
+	return gitOutputTrimmed(ctx, g, "for-each-ref", "--format=%(upstream:short)", "refs/heads/"+branch)
+}
+
+// localBranchDone is a gitPlanStep.Done check: satisfied when the local
+// branch exists.
+func localBranchDone(g consensus.Git, branch string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		exists, err := localBranchExists(ctx, g, branch)
+		if err != nil || !exists {
+			return "", err
+		}
+		return fmt.Sprintf("local branch %s exists", branch), nil
+	}
+}
+
+// trackingDone is a gitPlanStep.Done check: satisfied when the local branch
+// tracks <remote>/<branch>.
+func trackingDone(g consensus.Git, remote, branch string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		upstream, err := branchUpstream(ctx, g, branch)
+		if err != nil || upstream != remote+"/"+branch {
+			return "", err
+		}
+		return fmt.Sprintf("%s tracks %s", branch, upstream), nil
+	}
+}
+
+// onBranchDone is a gitPlanStep.Done check: satisfied when branch is checked
+// out.
+func onBranchDone(g consensus.Git, branch string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		current, err := gitOutputTrimmed(ctx, g, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil || current != branch {
+			return "", err
+		}
+		return fmt.Sprintf("already on %s", branch), nil
+	}
+}
+
+// pushedDone is a gitPlanStep.Done check for `git push -u <remote> <branch>`:
+// satisfied when the branch tracks <remote>/<branch> and both point at the
+// same commit (as of the last fetch).
+func pushedDone(g consensus.Git, remote, branch string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		upstream, err := branchUpstream(ctx, g, branch)
+		if err != nil || upstream != remote+"/"+branch {
+			return "", err
+		}
+		local, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+		if err != nil {
+			return "", nil
+		}
+		pushed, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", "--quiet", "refs/remotes/"+upstream)
+		if err != nil || pushed != local {
+			return "", nil
+		}
+		return fmt.Sprintf("%s tracks %s and is up to date", branch, upstream), nil
+	}
+}
+
+// resolveTwigRemote returns the remote the shared twig is fetched from:
+// mob-consensus.twigRemote when configured, else remote (the onboarding
+// fetch/push remote).
+func resolveTwigRemote(ctx context.Context, g consensus.Git, remote string) (string, error) {
+	policy, err := consensus.Runner{Git: g}.Policy(ctx)
+	if err != nil {
+		return "", err
+	}
+	if policy.TwigRemote != "" {
+		return policy.TwigRemote, nil
+	}
+	return remote, nil
+}
+
+// remoteLabel describes the onboarding remotes for plan titles, mentioning the
+// twig remote only when it differs from the push remote.
+func remoteLabel(remote, twigRemote string) string {
+	if twigRemote == remote {
+		return "remote=" + remote
+	}
+	return "remote=" + remote + ", twig-remote=" + twigRemote
+}
+
+// fetchSteps returns one `git fetch` step per distinct remote.
+func fetchSteps(remotes ...string) []gitPlanStep {
+	var steps []gitPlanStep
+	seen := map[string]bool{}
+	for _, remote := range remotes {
+		if seen[remote] {
+			continue
+		}
+		seen[remote] = true
+		steps = append(steps, gitPlanStep{
+			Explain: fmt.Sprintf("Fetch remote refs from %s", remote),
+			Args: func(ctx context.Context) ([]string, error) {
+				return []string{"fetch", remote}, nil
+			},
+		})
+	}
+	return steps
+}
+
+// checkOnboardingTree refuses a dirty tree for --plan/--dry-run, which must
+// not change anything, and otherwise offers to commit it before
+// init/start/join switch branches.
+func checkOnboardingTree(ctx context.Context, g consensus.Git, opts options, stdout io.Writer) error {
 	if opts.plan || opts.dryRun {
-		dirty, err := isDirty(ctx)
+		dirty, err := isDirty(ctx, g)
 		if err != nil {
 			return err
 		}
 		if dirty {
 			return usageError{Err: errors.New("mob-consensus: working tree is dirty (clean it before using --plan/--dry-run)")}
 		}
-	} else {
-		execOpts := opts
-		execOpts.noPush = true
-		if err := ensureClean(ctx, execOpts, true, stdout); err != nil {
-			return err
-		}
+		return nil
 	}
+	execOpts := opts
+	execOpts.noPush = true
+	return ensureClean(ctx, g, execOpts, true, stdout)
+}
 
-	twig, err := resolveTwig(cmdInit, opts, currentBranch, user, stderr)
+// initFlow is what `init` resolves before fetching: the twig, the remote
+// personal branches are pushed to, and the remote holding the shared twig.
+type initFlow struct {
+	title      string
+	twig       string
+	remote     string
+	twigRemote string
+}
+
+// resolveInitFlow resolves the twig and remotes for `init`.
+func resolveInitFlow(ctx context.Context, g consensus.Git, opts options, user, currentBranch string, stderr io.Writer) (initFlow, error) {
+	naming, err := consensus.Runner{Git: g}.Naming(ctx)
+	if err != nil {
+		return initFlow{}, err
+	}
+	twig, err := resolveTwig(ctx, g, cmdInit, opts, naming, currentBranch, user, stderr)
 	if err != nil {
-		return usageError{Err: err}
+		return initFlow{}, usageError{Err: err}
 	}
-	if err := validateBranchName(ctx, "twig", twig); err != nil {
-		return usageError{Err: err}
+	if err := validateBranchName(ctx, g, "twig", twig); err != nil {
+		return initFlow{}, usageError{Err: err}
 	}
 
-	remote, err := resolveRemote(ctx, cmdInit, opts, stderr)
+	remote, err := resolveRemote(ctx, g, cmdInit, opts, stderr)
 	if err != nil {
-		return usageError{Err: err}
+		return initFlow{}, usageError{Err: err}
+	}
+	twigRemote, err := resolveTwigRemote(ctx, g, remote)
+	if err != nil {
+		return initFlow{}, err
+	}
+	return initFlow{
+		title:      fmt.Sprintf("mob-consensus init (twig=%s, %s)", twig, remoteLabel(remote, twigRemote)),
+		twig:       twig,
+		remote:     remote,
+		twigRemote: twigRemote,
+	}, nil
+}
+
+// plan returns the steps `init --plan` shows: the fetch, then the join or
+// start that follows it. The base ref is only a suggestion, since only the
+// start path needs one.
+func (f initFlow) plan(ctx context.Context, g consensus.Git, opts options, currentBranch string) ([]plannedStep, error) {
+	steps, err := planSteps(ctx, g, fetchSteps(f.twigRemote))
+	if err != nil {
+		return nil, err
+	}
+	base := resolveBase(opts, currentBranch)
+	baseHint := ""
+	if base == "" || base == "HEAD" {
+		base = "<ref>"
+		baseHint = " (hint: pass --base <ref>)"
+	}
+	return append(steps, plannedStep{
+		Explain: fmt.Sprintf("If %s/%s exists, run: mob-consensus join --twig %s", f.twigRemote, f.twig, f.twig),
+		Lines:   []string{fmt.Sprintf("Otherwise run: mob-consensus start --twig %s --base %s%s", f.twig, base, baseHint)},
+	}), nil
+}
+
+// runInit implements `mob-consensus init`. It fetches remote refs, checks
+// whether the shared twig exists on the remote, then suggests (or runs) either
+// `start` (first member) or `join` (next members).
+//
+// `init` intentionally does not assume a base ref unless it needs to run the
+// `start` path; this keeps `init` usable in detached-HEAD repos when the twig
+// already exists and `join` is sufficient.
+func runInit(ctx context.Context, g consensus.Git, opts options, user, currentBranch string, stdout, stderr io.Writer) error {
+	if err := checkOnboardingTree(ctx, g, opts, stdout); err != nil {
+		return err
 	}
 
-	title := fmt.Sprintf("mob-consensus init (twig=%s, remote=%s)", twig, remote)
+	flow, err := resolveInitFlow(ctx, g, opts, user, currentBranch, stderr)
+	if err != nil {
+		return err
+	}
 	if opts.plan || opts.dryRun {
-		baseSuggestion := resolveBase(opts, currentBranch)
-		baseHint := ""
-		if baseSuggestion == "" || baseSuggestion == "HEAD" {
-			baseSuggestion = "<ref>"
-			baseHint = " (hint: pass --base <ref>)"
+		steps, err := flow.plan(ctx, g, opts, currentBranch)
+		if err != nil {
+			return err
 		}
-
-		fmt.Fprintln(stdout, title)
-		fmt.Fprintf(stdout, "  1) Fetch remote refs:\n       git fetch %s\n", remote)
-		fmt.Fprintf(stdout, "  2) If %s/%s exists, run: mob-consensus join --twig %s\n", remote, twig, twig)
-		fmt.Fprintf(stdout, "     Otherwise run:        mob-consensus start --twig %s --base %s%s\n", twig, baseSuggestion, baseHint)
+		printPlan(stdout, flow.title, steps)
 		return nil
 	}
 
-	fetchStep := []gitPlanStep{
-		{
-			Explain: fmt.Sprintf("Fetch remote refs from %s", remote),
-			Args: func(ctx context.Context) ([]string, error) {
-				return []string{"fetch", remote}, nil
-			},
-		},
-	}
-	if err := runGitPlan(ctx, opts, title, fetchStep, stdout, stderr); err != nil {
+	if err := runGitPlan(ctx, g, opts, flow.title, fetchSteps(flow.twigRemote), stdout, stderr); err != nil {
 		return err
 	}
 
-	exists, err := remoteTrackingBranchExists(ctx, remote, twig)
+	twig, remote := flow.twig, flow.remote
+	exists, err := remoteTrackingBranchExists(ctx, g, flow.twigRemote, twig)
 	if err != nil {
 		return err
 	}
@@ -762,7 +1007,7 @@ func runInit(ctx context.Context, opts options, user, currentBranch string, stdo
 		if nextCmd == cmdJoin {
 			action = "join"
 		}
-		ok, err := confirm(os.Stdin, stderr, fmt.Sprintf("Suggested: mob-consensus %s --twig %s (remote=%s). Continue? [y/N]: ", action, twig, remote))
+		ok, err := confirm(opts.console.in, stderr, fmt.Sprintf("Suggested: mob-consensus %s --twig %s (remote=%s). Continue? [y/N]: ", action, twig, remote))
 		if err != nil {
 			return err
 		}
@@ -778,9 +1023,9 @@ func runInit(ctx context.Context, opts options, user, currentBranch string, stdo
 
 	switch nextCmd {
 	case cmdJoin:
-		return runJoin(ctx, next, user, currentBranch, stdout, stderr)
+		return runJoin(ctx, g, next, user, currentBranch, stdout, stderr)
 	default:
-		return runStart(ctx, next, user, currentBranch, stdout, stderr)
+		return runStart(ctx, g, next, user, currentBranch, stdout, stderr)
 	}
 }
 
@@ -790,94 +1035,92 @@ func runInit(ctx context.Context, opts options, user, currentBranch string, stdo
 //   3) push the twig (required so others can join)
 //   4) create/switch to the user's personal branch (<user>/<twig>)
 //   5) push the personal branch
-func runStart(ctx context.Context, opts options, user, currentBranch string, stdout, stderr io.Writer) error {
-	if opts.plan || opts.dryRun {
-		dirty, err := isDirty(ctx)
-		if err != nil {
-			return err
-		}
-		if dirty {
-			return usageError{Err: errors.New("mob-consensus: working tree is dirty (clean it before using --plan/--dry-run)")}
-		}
-	} else {
-		execOpts := opts
-		execOpts.noPush = true
-		if err := ensureClean(ctx, execOpts, true, stdout); err != nil {
-			return err
-		}
+func runStart(ctx context.Context, g consensus.Git, opts options, user, currentBranch string, stdout, stderr io.Writer) error {
+	if err := checkOnboardingTree(ctx, g, opts, stdout); err != nil {
+		return err
 	}
+	title, steps, err := startSteps(ctx, g, opts, user, currentBranch, stderr)
+	if err != nil {
+		return err
+	}
+	return runGitPlan(ctx, g, opts, title, steps, stdout, stderr)
+}
 
-	twig, err := resolveTwig(cmdStart, opts, currentBranch, user, stderr)
+// startSteps resolves the twig, remotes, and base for `start` and returns
+// the plan title and steps.
+func startSteps(ctx context.Context, g consensus.Git, opts options, user, currentBranch string, stderr io.Writer) (string, []gitPlanStep, error) {
+	naming, err := consensus.Runner{Git: g}.Naming(ctx)
 	if err != nil {
-		return usageError{Err: err}
+		return "", nil, err
 	}
-	if err := validateBranchName(ctx, "twig", twig); err != nil {
-		return usageError{Err: err}
+	twig, err := resolveTwig(ctx, g, cmdStart, opts, naming, currentBranch, user, stderr)
+	if err != nil {
+		return "", nil, usageError{Err: err}
+	}
+	if err := validateBranchName(ctx, g, "twig", twig); err != nil {
+		return "", nil, usageError{Err: err}
 	}
 
-	remote, err := resolveRemote(ctx, cmdStart, opts, stderr)
+	remote, err := resolveRemote(ctx, g, cmdStart, opts, stderr)
+	if err != nil {
+		return "", nil, usageError{Err: err}
+	}
+	twigRemote, err := resolveTwigRemote(ctx, g, remote)
 	if err != nil {
-		return usageError{Err: err}
+		return "", nil, err
 	}
 
 	base := resolveBase(opts, currentBranch)
 	if base == "" || base == "HEAD" {
-		return usageError{Err: errors.New("mob-consensus: could not determine a base ref (hint: pass --base <ref>)")}
+		return "", nil, usageError{Err: errors.New("mob-consensus: could not determine a base ref (hint: pass --base <ref>)")}
 	}
 
-	userBranch := user + "/" + twig
-	if err := validateBranchName(ctx, "personal branch", userBranch); err != nil {
-		return usageError{Err: err}
+	userBranch := naming.Branch(user, twig)
+	if err := validateBranchName(ctx, g, "personal branch", userBranch); err != nil {
+		return "", nil, usageError{Err: err}
 	}
 
-	title := fmt.Sprintf("mob-consensus start (twig=%s, base=%s, remote=%s, user=%s)", twig, base, remote, user)
-	steps := []gitPlanStep{
-		{
-			Explain: fmt.Sprintf("Fetch remote refs from %s", remote),
-			Args: func(ctx context.Context) ([]string, error) {
-				return []string{"fetch", remote}, nil
-			},
-		},
+	title := fmt.Sprintf("mob-consensus start (twig=%s, base=%s, %s, user=%s)", twig, base, remoteLabel(remote, twigRemote), user)
+	steps := append(fetchSteps(remote, twigRemote), []gitPlanStep{
 		{
 			Explain: fmt.Sprintf("Create/switch to shared twig branch %q", twig),
 			Pre: func(ctx context.Context) error {
-				localExists, err := localBranchExists(ctx, twig)
+				localExists, err := localBranchExists(ctx, g, twig)
 				if err != nil {
 					return err
 				}
 				if localExists {
 					return nil
 				}
-				remoteExists, err := remoteTrackingBranchExists(ctx, remote, twig)
-				if err != nil {
-					return err
-				}
-				if remoteExists {
-					return usageError{Err: fmt.Errorf("mob-consensus: shared twig %q already exists on %s (hint: use `mob-consensus join --twig %s`)", twig, remote, twig)}
+				for _, r := range []string{remote, twigRemote} {
+					remoteExists, err := remoteTrackingBranchExists(ctx, g, r, twig)
+					if err != nil {
+						return err
+					}
+					if remoteExists {
+						return usageError{Err: fmt.Errorf("mob-consensus: shared twig %q already exists on %s (hint: use `mob-consensus join --twig %s`)", twig, r, twig)}
+					}
 				}
 				return nil
 			},
 			Args: func(ctx context.Context) ([]string, error) {
-				exists, err := localBranchExists(ctx, twig)
-				if err != nil {
-					return nil, err
-				}
-				if exists {
-					return []string{"checkout", twig}, nil
-				}
 				return []string{"checkout", "-b", twig, base}, nil
 			},
+			// The personal branch is created from the local twig, so an
+			// existing twig needn't be checked out.
+			Done: localBranchDone(g, twig),
 		},
 		{
 			Explain: fmt.Sprintf("Push shared twig %q (required so others can join)", twig),
 			Args: func(ctx context.Context) ([]string, error) {
 				return []string{"push", "-u", remote, twig}, nil
 			},
+			Done: pushedDone(g, remote, twig),
 		},
 		{
 			Explain: fmt.Sprintf("Create/switch to your personal branch %q", userBranch),
 			Args: func(ctx context.Context) ([]string, error) {
-				exists, err := localBranchExists(ctx, userBranch)
+				exists, err := localBranchExists(ctx, g, userBranch)
 				if err != nil {
 					return nil, err
 				}
@@ -885,7 +1128,7 @@ func runStart(ctx context.Context, opts options, user, currentBranch string, std
 					return []string{"checkout", userBranch}, nil
 				}
 
-				remoteExists, err := remoteTrackingBranchExists(ctx, remote, userBranch)
+				remoteExists, err := remoteTrackingBranchExists(ctx, g, remote, userBranch)
 				if err != nil {
 					return nil, err
 				}
@@ -894,15 +1137,17 @@ func runStart(ctx context.Context, opts options, user, currentBranch string, std
 				}
 				return []string{"checkout", "-b", userBranch, twig}, nil
 			},
+			Done: onBranchDone(g, userBranch),
 		},
 		{
 			Explain: fmt.Sprintf("Push your personal branch %q", userBranch),
 			Args: func(ctx context.Context) ([]string, error) {
 				return []string{"push", "-u", remote, userBranch}, nil
 			},
+			Done: pushedDone(g, remote, userBranch),
 		},
-	}
-	return runGitPlan(ctx, opts, title, steps, stdout, stderr)
+	}...)
+	return title, steps, nil
 }
 
 // runJoin implements the "next group member" onboarding flow:
@@ -910,76 +1155,95 @@ func runStart(ctx context.Context, opts options, user, currentBranch string, std
 //   2) create a local twig branch tracking <remote>/<twig> (if needed)
 //   3) create/switch to the user's personal branch (<user>/<twig>)
 //   4) push the personal branch
-func runJoin(ctx context.Context, opts options, user, currentBranch string, stdout, stderr io.Writer) error {
+//
+// If the checked-out tree has a collaborator roster, runJoin then runs
+// `team sync` with the same plan options.
+func runJoin(ctx context.Context, g consensus.Git, opts options, user, currentBranch string, stdout, stderr io.Writer) error {
+	if err := checkOnboardingTree(ctx, g, opts, stdout); err != nil {
+		return err
+	}
+	title, steps, err := joinSteps(ctx, g, opts, user, currentBranch, stderr)
+	if err != nil {
+		return err
+	}
+	if err := runGitPlan(ctx, g, opts, title, steps, stdout, stderr); err != nil {
+		return err
+	}
 	if opts.plan || opts.dryRun {
-		dirty, err := isDirty(ctx)
-		if err != nil {
-			return err
-		}
-		if dirty {
-			return usageError{Err: errors.New("mob-consensus: working tree is dirty (clean it before using --plan/--dry-run)")}
-		}
-	} else {
-		execOpts := opts
-		execOpts.noPush = true
-		if err := ensureClean(ctx, execOpts, true, stdout); err != nil {
-			return err
-		}
+		return nil
 	}
 
-	twig, err := resolveTwig(cmdJoin, opts, currentBranch, user, stderr)
+	// The roster arrives with the twig; wire up every collaborator's fork now
+	// instead of leaving `git remote add` to each new member.
+	_, hasTeam, err := consensus.Runner{Git: g}.LoadTeam(ctx)
+	if err != nil || !hasTeam {
+		return err
+	}
+	fmt.Fprintln(stdout)
+	return runTeamSync(ctx, g, opts, user, stdout, stderr)
+}
+
+// joinSteps resolves the twig and remotes for `join` and returns the plan
+// title and steps.
+func joinSteps(ctx context.Context, g consensus.Git, opts options, user, currentBranch string, stderr io.Writer) (string, []gitPlanStep, error) {
+	naming, err := consensus.Runner{Git: g}.Naming(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	twig, err := resolveTwig(ctx, g, cmdJoin, opts, naming, currentBranch, user, stderr)
 	if err != nil {
-		return usageError{Err: err}
+		return "", nil, usageError{Err: err}
 	}
-	if err := validateBranchName(ctx, "twig", twig); err != nil {
-		return usageError{Err: err}
+	if err := validateBranchName(ctx, g, "twig", twig); err != nil {
+		return "", nil, usageError{Err: err}
 	}
 
-	remote, err := resolveRemote(ctx, cmdJoin, opts, stderr)
+	remote, err := resolveRemote(ctx, g, cmdJoin, opts, stderr)
+	if err != nil {
+		return "", nil, usageError{Err: err}
+	}
+	twigRemote, err := resolveTwigRemote(ctx, g, remote)
 	if err != nil {
-		return usageError{Err: err}
+		return "", nil, err
 	}
 
-	userBranch := user + "/" + twig
-	if err := validateBranchName(ctx, "personal branch", userBranch); err != nil {
-		return usageError{Err: err}
+	userBranch := naming.Branch(user, twig)
+	if err := validateBranchName(ctx, g, "personal branch", userBranch); err != nil {
+		return "", nil, usageError{Err: err}
 	}
 
-	title := fmt.Sprintf("mob-consensus join (twig=%s, remote=%s, user=%s)", twig, remote, user)
-	steps := []gitPlanStep{
-		{
-			Explain: fmt.Sprintf("Fetch remote refs from %s", remote),
-			Args: func(ctx context.Context) ([]string, error) {
-				return []string{"fetch", remote}, nil
-			},
-		},
+	title := fmt.Sprintf("mob-consensus join (twig=%s, %s, user=%s)", twig, remoteLabel(remote, twigRemote), user)
+	steps := append(fetchSteps(twigRemote, remote), []gitPlanStep{
 		{
-			Explain: fmt.Sprintf("Create/switch to shared twig branch %q tracking %s/%s", twig, remote, twig),
+			Explain: fmt.Sprintf("Create/switch to shared twig branch %q tracking %s/%s", twig, twigRemote, twig),
 			Pre: func(ctx context.Context) error {
-				remoteExists, err := remoteTrackingBranchExists(ctx, remote, twig)
+				remoteExists, err := remoteTrackingBranchExists(ctx, g, twigRemote, twig)
 				if err != nil {
 					return err
 				}
 				if !remoteExists {
-					return usageError{Err: fmt.Errorf("mob-consensus: shared twig %q not found on %s (hint: ask the first member to run `mob-consensus start --twig %s`)", twig, remote, twig)}
+					return usageError{Err: fmt.Errorf("mob-consensus: shared twig %q not found on %s (hint: ask the first member to run `mob-consensus start --twig %s`)", twig, twigRemote, twig)}
 				}
 				return nil
 			},
 			Args: func(ctx context.Context) ([]string, error) {
-				exists, err := localBranchExists(ctx, twig)
+				exists, err := localBranchExists(ctx, g, twig)
 				if err != nil {
 					return nil, err
 				}
 				if exists {
-					return []string{"checkout", twig}, nil
+					// A local twig without the right upstream (ex: created
+					// by hand) only needs its tracking fixed.
+					return []string{"branch", "--set-upstream-to=" + twigRemote + "/" + twig, twig}, nil
 				}
-				return []string{"checkout", "-b", twig, remote + "/" + twig}, nil
+				return []string{"checkout", "-b", twig, twigRemote + "/" + twig}, nil
 			},
+			Done: trackingDone(g, twigRemote, twig),
 		},
 		{
 			Explain: fmt.Sprintf("Create/switch to your personal branch %q", userBranch),
 			Args: func(ctx context.Context) ([]string, error) {
-				exists, err := localBranchExists(ctx, userBranch)
+				exists, err := localBranchExists(ctx, g, userBranch)
 				if err != nil {
 					return nil, err
 				}
@@ -987,7 +1251,7 @@ func runJoin(ctx context.Context, opts options, user, currentBranch string, stdo
 					return []string{"checkout", userBranch}, nil
 				}
 
-				remoteExists, err := remoteTrackingBranchExists(ctx, remote, userBranch)
+				remoteExists, err := remoteTrackingBranchExists(ctx, g, remote, userBranch)
 				if err != nil {
 					return nil, err
 				}
@@ -996,28 +1260,31 @@ func runJoin(ctx context.Context, opts options, user, currentBranch string, stdo
 				}
 				return []string{"checkout", "-b", userBranch, twig}, nil
 			},
+			Done: onBranchDone(g, userBranch),
 		},
 		{
 			Explain: fmt.Sprintf("Push your personal branch %q", userBranch),
 			Args: func(ctx context.Context) ([]string, error) {
 				return []string{"push", "-u", remote, userBranch}, nil
 			},
+			Done: pushedDone(g, remote, userBranch),
 		},
-	}
-	return runGitPlan(ctx, opts, title, steps, stdout, stderr)
+	}...)
+	return title, steps, nil
 }
 
 // runCreateBranch implements `mob-consensus branch create`.
 //
-// It creates (or switches to) the user's personal branch "<user>/<twig>" based
-// on opts.base. This command does not push; instead it prints a suggested
-// `git push -u ...` so the user can choose the remote explicitly when needed.
-func runCreateBranch(ctx context.Context, opts options, user string, stdout io.Writer) error {
+// It creates (or switches to) the user's personal branch (see
+// consensus.Naming; "<user>/<twig>" by default) based on opts.base. This
+// command does not push; instead it prints a suggested `git push -u ...` so
+// the user can choose the remote explicitly when needed.
+func runCreateBranch(ctx context.Context, g consensus.Git, opts options, user string, stdout io.Writer) error {
 	twig := strings.TrimSpace(opts.twig)
 	if twig == "" {
 		return errors.New("mob-consensus: twig is empty")
 	}
-	if err := validateBranchName(ctx, "twig", twig); err != nil {
+	if err := validateBranchName(ctx, g, "twig", twig); err != nil {
 		return err
 	}
 
@@ -1026,41 +1293,45 @@ func runCreateBranch(ctx context.Context, opts options, user string, stdout io.W
 		return errors.New("mob-consensus: base ref is empty")
 	}
 
-	newBranch := user + "/" + twig
-	if err := validateBranchName(ctx, "personal branch", newBranch); err != nil {
+	naming, err := consensus.Runner{Git: g}.Naming(ctx)
+	if err != nil {
+		return err
+	}
+	newBranch := naming.Branch(user, twig)
+	if err := validateBranchName(ctx, g, "personal branch", newBranch); err != nil {
 		return err
 	}
 
-	if err := ensureClean(ctx, opts, true, stdout); err != nil {
+	if err := ensureClean(ctx, g, opts, true, stdout); err != nil {
 		return err
 	}
 
-	existingBranches, err := gitOutput(ctx, "branch", "--list", newBranch)
+	existingBranches, err := g.Output(ctx, "branch", "--list", newBranch)
 	if err != nil {
 		return err
 	}
 	if strings.TrimSpace(existingBranches) != "" {
-		if err := gitRun(ctx, "checkout", newBranch); err != nil {
+		if err := g.Run(ctx, "checkout", newBranch); err != nil {
 			return err
 		}
 		fmt.Fprintln(stdout)
 		fmt.Fprintln(stdout, "Next: push your branch when you're ready.")
-		return printPushAdvice(ctx, stdout, newBranch)
+		return printPushAdvice(ctx, g, stdout, newBranch)
 	}
 
-	if err := gitRun(ctx, "checkout", "-b", newBranch, baseRef); err != nil {
+	if err := g.Run(ctx, "checkout", "-b", newBranch, baseRef); err != nil {
 		return err
 	}
 	fmt.Fprintln(stdout)
 	fmt.Fprintln(stdout, "Next: push your branch when you're ready.")
-	return printPushAdvice(ctx, stdout, newBranch)
+	return printPushAdvice(ctx, g, stdout, newBranch)
 }
 
 // printPushAdvice prints an explicit `git push -u ...` suggestion. If the
 // remote choice is unambiguous (upstream remote or only remote) we print that
 // remote; otherwise we print a placeholder and list available remotes.
-func printPushAdvice(ctx context.Context, w io.Writer, branch string) error {
-	remote, remotes, _ := suggestedRemote(ctx)
+func printPushAdvice(ctx context.Context, g consensus.Git, w io.Writer, branch string) error {
+	remote, remotes, _ := consensus.Runner{Git: g}.SuggestedRemote(ctx)
 	if remote != "" {
 		fmt.Fprintf(w, "  git push -u %s %s\n", remote, branch)
 		return nil
@@ -1079,42 +1350,155 @@ func printPushAdvice(ctx context.Context, w io.Writer, branch string) error {
 // runDiscovery implements `mob-consensus status`. It lists branches that end in
 // "/<twig>" (for the current twig) and prints whether each branch is ahead,
 // behind, diverged, or synced relative to the current branch.
-func runDiscovery(ctx context.Context, opts options, currentBranch string, stdout io.Writer) error {
+func runDiscovery(ctx context.Context, g consensus.Git, opts options, currentBranch string, stdout io.Writer) error {
 	if opts.commitDirty {
-		if err := ensureClean(ctx, opts, false, stdout); err != nil {
+		if err := ensureClean(ctx, g, opts, false, stdout); err != nil {
+			return err
+		}
+	}
+
+	if opts.matrix {
+		m, err := consensus.Runner{Git: g}.Matrix(ctx, currentBranch)
+		if err != nil {
 			return err
 		}
+		if opts.format == formatJSON {
+			return writeMatrixJSON(stdout, m)
+		}
+		writeMatrixText(stdout, m)
+		return nil
+	}
+
+	d, err := consensus.Runner{Git: g}.Discover(ctx, currentBranch)
+	if err != nil {
+		return err
 	}
 
-	twig := twigFromBranch(currentBranch)
-	out, err := gitOutput(ctx, "branch", "-a")
+	repo := consensus.Runner{Git: g}
+	remotes, err := repo.Remotes(ctx)
+	if err != nil {
+		return err
+	}
+	lastFetch, err := repo.LastFetch(ctx, remotes)
+	if err != nil {
+		return err
+	}
+	email, _ := gitOutputTrimmed(ctx, g, "config", "--get", "user.email")
+	user, _ := repo.User(ctx)
+	clashes, err := repo.LabelClashes(ctx, d, email, user)
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
+	v := statusView{d: d, remotes: remotes, lastFetch: lastFetch, fetched: !opts.noFetch, now: now, stale: opts.stale, clashes: clashes}
+	switch opts.format {
+	case formatJSON:
+		return writeStatusJSON(stdout, v)
+	case formatNDJSON:
+		return writeStatusNDJSON(stdout, v)
+	}
+
 	fmt.Fprintln(stdout)
 	fmt.Fprintln(stdout)
 	fmt.Fprintln(stdout, "Related branches and their diffs (if any):")
 	fmt.Fprintln(stdout)
 
-	for _, b := range relatedBranches(out, twig) {
-		if b == currentBranch {
-			continue
+	for _, b := range d.Branches {
+		fmt.Fprintln(stdout, diffStatusLine(b.Branch, b.Ahead, b.Behind)+mergePredictionSuffix(b.Merge))
+		fmt.Fprintln(stdout, activityLine(b, now, opts.stale))
+	}
+	if len(clashes) > 0 {
+		fmt.Fprintln(stdout)
+		for _, c := range clashes {
+			fmt.Fprintln(stdout, labelClashLine(c))
 		}
-		ahead, err := gitOutput(ctx, "diff", "--shortstat", "..."+b)
-		if err != nil {
-			return err
+	}
+	if len(remotes) > 0 {
+		fmt.Fprintln(stdout)
+		fmt.Fprintln(stdout, lastFetchLine(v))
+	}
+	return nil
+}
+
+// statusView is everything `status` renders: the discovery plus how fresh
+// the remote-tracking refs are.
+type statusView struct {
+	d         consensus.Discovery
+	remotes   []string
+	lastFetch map[string]time.Time
+	// fetched is false with --no-fetch, or when a fetch failed and
+	// mob-consensus.allowOffline let status continue.
+	fetched bool
+	now     time.Time
+	stale   time.Duration
+	// clashes are the <user> labels more than one person works under.
+	clashes []consensus.LabelClash
+}
+
+// labelClashLine warns that several people share the <user> label of c.
+func labelClashLine(c consensus.LabelClash) string {
+	return fmt.Sprintf("Warning: <user> %q is used by %s; their branches collide (hint: give each email its own label under [labels] in %s, or set git config %s; note that a peer's %s is local to their clone, so clashes it causes can't be seen here)",
+		c.User, strings.Join(c.Emails, " and "), consensus.TeamFile, consensus.ConfigUser, consensus.ConfigUser)
+}
+
+// labelClash reports whether user is one of the clashing labels in v.
+func (v statusView) labelClash(user string) bool {
+	for _, c := range v.clashes {
+		if c.User == user {
+			return true
 		}
-		behind, err := gitOutput(ctx, "diff", "--shortstat", b+"...")
-		if err != nil {
-			return err
+	}
+	return false
+}
+
+// lastFetchLine summarizes the age of each remote's last fetch (ex: "Last
+// fetch: origin 5m ago, upstream never").
+func lastFetchLine(v statusView) string {
+	var parts []string
+	for _, remote := range v.remotes {
+		if t, ok := v.lastFetch[remote]; ok {
+			parts = append(parts, fmt.Sprintf("%s %s ago", remote, formatAge(v.now.Sub(t))))
+		} else {
+			parts = append(parts, remote+" never")
 		}
-		ahead = strings.TrimSpace(ahead)
-		behind = strings.TrimSpace(behind)
+	}
+	line := "Last fetch: " + strings.Join(parts, ", ")
+	if !v.fetched {
+		line += " (not fetched this run; remote branches may be stale)"
+	}
+	return line
+}
 
-		fmt.Fprintln(stdout, diffStatusLine(b, ahead, behind))
+// activityLine is the second status line for a related branch: commit
+// counts in both directions and the tip commit, aligned under the diff
+// status. With a stale window, idle branches are flagged.
+func activityLine(b consensus.BranchStatus, now time.Time, stale time.Duration) string {
+	line := fmt.Sprintf("%40s  commits: %d ahead, %d behind; last: %s ago by %s: %s",
+		"", b.AheadCommits, b.BehindCommits, formatAge(b.Idle(now)), b.TipAuthor, b.TipSubject)
+	if isStale(b, now, stale) {
+		line += fmt.Sprintf("; stale (no commits in %s)", formatAge(stale))
+	}
+	return line
+}
+
+// isStale reports whether b has had no commits within the stale window; a
+// zero window disables the check.
+func isStale(b consensus.BranchStatus, now time.Time, stale time.Duration) bool {
+	return stale > 0 && b.Idle(now) > stale
+}
+
+// mergePredictionSuffix describes a trial merge for a status line, or
+// returns "" when there is none.
+func mergePredictionSuffix(p *consensus.MergePrediction) string {
+	switch {
+	case p == nil:
+		return ""
+	case p.Clean():
+		return "; merge: clean"
+	default:
+		return fmt.Sprintf("; merge: conflicts in %s (%s)", countNoun(len(p.Conflicts), "file"), strings.Join(p.Conflicts, ", "))
 	}
-	return nil
 }
 
 // diffStatusLine formats a single discovery line based on symmetric-diff
@@ -1132,29 +1516,314 @@ func diffStatusLine(branch, ahead, behind string) string {
 	}
 }
 
+// Output formats for `mob-consensus status --format`.
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// statusSchemaVersion versions the `status --format json|ndjson` documents.
+// Adding fields is compatible; renaming/removing fields or changing their
+// meaning requires a bump so scripts can detect the change.
+const statusSchemaVersion = 1
+
+// statusJSON is the `status --format json` document.
+type statusJSON struct {
+	SchemaVersion int          `json:"schema_version"`
+	CurrentBranch string       `json:"current_branch"`
+	Head          string       `json:"head"`
+	Twig          string       `json:"twig"`
+	Branches      []branchJSON `json:"branches"`
+	// Fetched is false when this run used the local remote-tracking refs
+	// without fetching (--no-fetch, or a failed fetch with
+	// mob-consensus.allowOffline). Remotes tells how old those refs are.
+	Fetched bool         `json:"fetched"`
+	Remotes []remoteJSON `json:"remotes"`
+	// LabelClashes lists the <user> labels that more than one person
+	// (email) works under.
+	LabelClashes []labelClashJSON `json:"label_clashes"`
+}
+
+// labelClashJSON is a consensus.LabelClash.
+type labelClashJSON struct {
+	User   string   `json:"user"`
+	Emails []string `json:"emails"`
+}
+
+// remoteJSON describes a configured remote. LastFetch (RFC 3339) is omitted
+// when the remote was never fetched.
+type remoteJSON struct {
+	Name      string `json:"name"`
+	LastFetch string `json:"last_fetch,omitempty"`
+}
+
+// branchJSON describes one related branch. In ndjson output each line is a
+// branchJSON that also carries the schema version and current branch, so
+// every line stands on its own.
+type branchJSON struct {
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	CurrentBranch string `json:"current_branch,omitempty"`
+
+	Name   string   `json:"name"`
+	Remote string   `json:"remote"`
+	User   string   `json:"user"`
+	Twig   string   `json:"twig"`
+	State  string   `json:"state"`
+	Tip    string   `json:"tip"`
+	Ahead  sideJSON `json:"ahead"`
+	Behind sideJSON `json:"behind"`
+	// TipAuthor, TipTime (RFC 3339 committer date), and TipSubject
+	// describe the tip commit. Stale is set when --stale is given and the
+	// tip is older than the window.
+	TipAuthor  string `json:"tip_author"`
+	TipTime    string `json:"tip_time"`
+	TipSubject string `json:"tip_subject"`
+	Stale      bool   `json:"stale"`
+	// LabelClash is set when more than one person works under User.
+	LabelClash bool `json:"label_clash"`
+	// LastFetch (RFC 3339) is when the remote of a remote-tracking branch
+	// was last fetched; omitted for local branches and unfetched remotes.
+	LastFetch string `json:"last_fetch,omitempty"`
+	// Merge is the trial merge into HEAD, for diverged branches only.
+	Merge *mergeJSON `json:"merge,omitempty"`
+}
+
+// mergeJSON is a consensus.MergePrediction.
+type mergeJSON struct {
+	Clean     bool     `json:"clean"`
+	Conflicts []string `json:"conflicts"`
+}
+
+// sideJSON holds the commit count and shortstat numbers for one side of a
+// comparison ("ahead": only on the related branch; "behind": only on HEAD).
+type sideJSON struct {
+	Commits    int `json:"commits"`
+	Files      int `json:"files"`
+	Insertions int `json:"insertions"`
+	Deletions  int `json:"deletions"`
+}
+
+// newBranchJSON converts an engine BranchStatus to its JSON form.
+func newBranchJSON(v statusView, b consensus.BranchStatus) branchJSON {
+	side := func(commits int, shortstat string) sideJSON {
+		st := consensus.ParseShortStat(shortstat)
+		return sideJSON{Commits: commits, Files: st.Files, Insertions: st.Insertions, Deletions: st.Deletions}
+	}
+	out := branchJSON{
+		Name:   b.Branch,
+		Remote: b.Remote,
+		User:   b.User,
+		Twig:   v.d.Twig,
+		State:  string(b.State()),
+		Tip:    b.Tip,
+		Ahead:  side(b.AheadCommits, b.Ahead),
+		Behind: side(b.BehindCommits, b.Behind),
+
+		TipAuthor:  b.TipAuthor,
+		TipTime:    formatJSONTime(b.TipTime),
+		TipSubject: b.TipSubject,
+		Stale:      isStale(b, v.now, v.stale),
+		LabelClash: v.labelClash(b.User),
+	}
+	if t, ok := v.lastFetch[b.Remote]; ok && b.Remote != "" {
+		out.LastFetch = formatJSONTime(t)
+	}
+	if b.Merge != nil {
+		out.Merge = &mergeJSON{Clean: b.Merge.Clean(), Conflicts: append([]string{}, b.Merge.Conflicts...)}
+	}
+	return out
+}
+
+// writeStatusJSON writes v as one indented statusJSON document.
+func writeStatusJSON(w io.Writer, v statusView) error {
+	doc := statusJSON{
+		SchemaVersion: statusSchemaVersion,
+		CurrentBranch: v.d.CurrentBranch,
+		Head:          v.d.Head,
+		Twig:          v.d.Twig,
+		Branches:      []branchJSON{},
+		Fetched:       v.fetched,
+		Remotes:       []remoteJSON{},
+		LabelClashes:  []labelClashJSON{},
+	}
+	for _, b := range v.d.Branches {
+		doc.Branches = append(doc.Branches, newBranchJSON(v, b))
+	}
+	for _, remote := range v.remotes {
+		r := remoteJSON{Name: remote}
+		if t, ok := v.lastFetch[remote]; ok {
+			r.LastFetch = formatJSONTime(t)
+		}
+		doc.Remotes = append(doc.Remotes, r)
+	}
+	for _, c := range v.clashes {
+		doc.LabelClashes = append(doc.LabelClashes, labelClashJSON{User: c.User, Emails: c.Emails})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// writeStatusNDJSON writes one compact branchJSON line per related branch.
+func writeStatusNDJSON(w io.Writer, v statusView) error {
+	enc := json.NewEncoder(w)
+	for _, b := range v.d.Branches {
+		line := newBranchJSON(v, b)
+		line.SchemaVersion = statusSchemaVersion
+		line.CurrentBranch = v.d.CurrentBranch
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatJSONTime renders t for JSON output: RFC 3339 in UTC.
+func formatJSONTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// matrixJSON is the `status --matrix --format json` document. It shares
+// statusSchemaVersion with the other status documents.
+type matrixJSON struct {
+	SchemaVersion int    `json:"schema_version"`
+	CurrentBranch string `json:"current_branch"`
+	Twig          string `json:"twig"`
+	// Consensus is true when every branch has the same tree.
+	Consensus bool `json:"consensus"`
+	// Branches and Tips are parallel; the current branch comes first.
+	Branches []string `json:"branches"`
+	Tips     []string `json:"tips"`
+	// Ahead[i][j] counts the commits on Branches[i] that Branches[j] lacks.
+	Ahead [][]int `json:"ahead"`
+}
+
+// writeMatrixJSON writes m as one indented matrixJSON document.
+func writeMatrixJSON(w io.Writer, m consensus.Matrix) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(matrixJSON{
+		SchemaVersion: statusSchemaVersion,
+		CurrentBranch: m.CurrentBranch,
+		Twig:          m.Twig,
+		Consensus:     m.Consensus,
+		Branches:      m.Branches,
+		Tips:          m.Tips,
+		Ahead:         m.Ahead,
+	})
+}
+
+// writeMatrixText prints m as a table: each cell counts the commits the row
+// branch has that the column branch lacks, with columns numbered after the
+// rows.
+func writeMatrixText(w io.Writer, m consensus.Matrix) {
+	nameWidth := 0
+	for _, b := range m.Branches {
+		nameWidth = max(nameWidth, len(b))
+	}
+	indexWidth := len(strconv.Itoa(len(m.Branches)))
+	cellWidth := indexWidth
+	for _, row := range m.Ahead {
+		for _, n := range row {
+			cellWidth = max(cellWidth, len(strconv.Itoa(n)))
+		}
+	}
+
+	fmt.Fprintf(w, "Convergence matrix for twig %s (commits on the row branch that the column branch lacks):\n", m.Twig)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%*s  %-*s", indexWidth, "", nameWidth, "")
+	for j := range m.Branches {
+		fmt.Fprintf(w, "  %*d", cellWidth, j+1)
+	}
+	fmt.Fprintln(w)
+	for i, b := range m.Branches {
+		fmt.Fprintf(w, "%*d  %-*s", indexWidth, i+1, nameWidth, b)
+		for j := range m.Branches {
+			if i == j {
+				fmt.Fprintf(w, "  %*s", cellWidth, "-")
+				continue
+			}
+			fmt.Fprintf(w, "  %*d", cellWidth, m.Ahead[i][j])
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+	if m.Consensus {
+		fmt.Fprintln(w, "Consensus reached: every branch has the same content.")
+	} else {
+		fmt.Fprintln(w, "Consensus not reached.")
+	}
+}
+
 // runMerge implements `mob-consensus merge`.
 //
 // It resolves the merge target (including remote shorthand), enforces a clean
 // tree (or auto-commits with -c), performs a no-ff/no-commit merge, launches
 // tools for conflict resolution and review, writes MERGE_MSG, commits, and
-// optionally pushes.
-func runMerge(ctx context.Context, opts options, currentBranch string, stdout io.Writer) error {
-	mergeTarget, needsConfirm, err := resolveMergeTarget(ctx, opts.otherBranch)
-	if err != nil {
-		var nf branchNotFoundError
-		if errors.As(err, &nf) {
-			// Mirror `mob-consensus status` by showing the related branch
-			// list, so the user can pick a valid branch.
-			_ = runDiscovery(ctx, options{}, currentBranch, stdout)
+// optionally pushes. Each step is journaled under .git/mob-consensus/, so
+// `merge --continue` can resume an interrupted merge and `merge --abort` can
+// undo it.
+func runMerge(ctx context.Context, g consensus.Git, opts options, currentBranch string, stdout io.Writer) error {
+	switch {
+	case opts.continueMerge:
+		return continueMerge(ctx, g, opts, stdout)
+	case opts.abortMerge:
+		return abortMerge(ctx, g, stdout)
+	}
+
+	repo := consensus.Runner{Git: g}
+	if _, err := repo.LoadMergeJournal(ctx); err == nil {
+		return errors.New("mob-consensus: a mob-consensus merge is already in progress (hint: mob-consensus merge --continue, or mob-consensus merge --abort)")
+	} else if !errors.Is(err, consensus.ErrNoMergeJournal) {
+		return err
+	}
+
+	targets := opts.others
+	if len(targets) == 0 {
+		targets = []string{opts.otherBranch}
+	}
+	var plans []consensus.MergePlan
+	for _, target := range targets {
+		plan, err := repo.PlanMerge(ctx, target, currentBranch)
+		if err != nil {
+			var nf consensus.BranchNotFoundError
+			if errors.As(err, &nf) {
+				// Mirror `mob-consensus status` by showing the related branch
+				// list, so the user can pick a valid branch.
+				_ = runDiscovery(ctx, g, options{}, currentBranch, stdout)
+			}
+			return err
 		}
+		plans = append(plans, plan)
+	}
+	plan := plans[0]
+	if len(plans) > 1 {
+		plan = consensus.OctopusPlan(plans)
+	}
+
+	// Check the tools up front: a missing mergetool should stop us before
+	// the merge starts, not leave the repo mid-merge. The mergetool is only
+	// needed when the merge conflicts, and not at all when we stop there.
+	review := reviewEnabled(ctx, g, opts)
+	tools, err := mergeTools(ctx, g, opts.mergeTool, opts.diffTool, opts.noDiffTool, review)
+	if err != nil {
 		return err
 	}
+	if !opts.stopOnConflict && mayConflict(ctx, repo, plan.Targets) {
+		if err := repo.CheckMergeTool(ctx, tools); err != nil {
+			return err
+		}
+	}
 
-	if err := ensureClean(ctx, opts, true, stdout); err != nil {
+	if err := ensureClean(ctx, g, opts, true, stdout); err != nil {
 		return err
 	}
-	if needsConfirm {
-		ok, err := confirm(os.Stdin, os.Stderr, fmt.Sprintf("Resolved %q to %q. Merge this branch? [y/N]: ", opts.otherBranch, mergeTarget))
+	for _, p := range plans {
+		if !p.NeedsConfirm {
+			continue
+		}
+		ok, err := confirm(opts.console.in, opts.console.errOut(), fmt.Sprintf("Resolved %q to %q. Merge this branch? [y/N]: ", p.Requested, p.Target))
 		if err != nil {
 			return err
 		}
@@ -1163,92 +1832,380 @@ func runMerge(ctx context.Context, opts options, currentBranch string, stdout io
 		}
 	}
 
-	mergeMsg, err := buildMergeMessage(ctx, mergeTarget, currentBranch)
+	origHead, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", "HEAD")
 	if err != nil {
 		return err
 	}
-
-	gitDir, err := gitOutputTrimmed(ctx, "rev-parse", "--git-dir")
-	if err != nil {
+	var targetCommits []string
+	for _, target := range plan.Targets {
+		commit, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", target+"^{commit}")
+		if err != nil {
+			return err
+		}
+		targetCommits = append(targetCommits, commit)
+	}
+	// Journal the merge before touching the worktree, so an interrupted
+	// merge can be resumed (--continue) or undone (--abort).
+	j := &consensus.MergeJournal{
+		Requested:     plan.Requested,
+		Target:        plan.Target,
+		Targets:       plan.Targets,
+		TargetCommits: targetCommits,
+		CurrentBranch: plan.CurrentBranch,
+		OrigHead:      origHead,
+		Message:       string(plan.Message),
+		Conflicts:     []string{},
+		Steps:         []consensus.MergeStep{},
+		MergeTool:     opts.mergeTool,
+		DiffTool:      opts.diffTool,
+		NoDiffTool:    opts.noDiffTool,
+		Review:        review,
+		NoAssist:      opts.noAssist,
+		NoPush:        opts.noPush || opts.deferPush,
+	}
+	if err := repo.SaveMergeJournal(ctx, j); err != nil {
 		return err
 	}
-	gitDir, err = filepath.Abs(gitDir)
+
+	mergeErr := g.Run(ctx, append([]string{"merge", "--no-commit", "--no-ff"}, plan.Targets...)...)
+	inProgress, err := mergeInProgress(ctx, g)
 	if err != nil {
 		return err
 	}
-	msgFile, err := os.CreateTemp(gitDir, "mob-consensus-*.msg")
-	if err != nil {
-		return err
+	if len(plans) > 1 && mergeErr != nil {
+		// git's octopus strategy refuses merges that need manual
+		// resolution; undo it and merge the targets one at a time.
+		if inProgress {
+			if err := g.Run(ctx, "merge", "--abort"); err != nil {
+				return err
+			}
+		}
+		if err := repo.RemoveMergeJournal(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "\nAn octopus merge of %s does not apply cleanly (git's octopus strategy can't stop for conflict resolution).\n", plan.Target)
+		fmt.Fprintf(stdout, "Falling back to %d sequential merges, one commit each.\n", len(plans))
+		return mergeSequentially(ctx, g, opts, plans, currentBranch, stdout)
+	}
+	if !inProgress {
+		// Nothing to commit (already up to date) or the merge never
+		// started: there is nothing to resume.
+		if err := repo.RemoveMergeJournal(ctx); err != nil {
+			return err
+		}
+		return mergeErr
 	}
-	msgPath := msgFile.Name()
-	defer os.Remove(msgPath)
-	if _, err := msgFile.Write(mergeMsg); err != nil {
-		_ = msgFile.Close()
-		return err
+	if mergeErr != nil {
+		// Remember what conflicted: once mergetool resolves it, the index
+		// no longer says which files were reviewed there.
+		if j.Conflicts, err = repo.ConflictedPaths(ctx); err != nil {
+			return err
+		}
 	}
-	if err := msgFile.Close(); err != nil {
+	j.Mark(consensus.MergeStepMerged)
+	if err := repo.SaveMergeJournal(ctx, j); err != nil {
 		return err
 	}
+	if opts.stopOnConflict && len(j.Conflicts) > 0 {
+		return mergeConflictError{Target: j.Target, Paths: j.Conflicts}
+	}
+	return finishMerge(ctx, g, j, tools, opts, stdout)
+}
 
-	mergeHeadPath, err := gitOutputTrimmed(ctx, "rev-parse", "--git-path", "MERGE_HEAD")
-	if err != nil {
-		return err
+// mergeSequentially is the fallback for an octopus merge that doesn't apply
+// cleanly: each target is merged (and reviewed and committed) on its own,
+// with a single push at the end.
+func mergeSequentially(ctx context.Context, g consensus.Git, opts options, plans []consensus.MergePlan, currentBranch string, stdout io.Writer) error {
+	for i, p := range plans {
+		fmt.Fprintf(stdout, "\n== Merge %d/%d: %s ==\n", i+1, len(plans), p.Target)
+		one := opts
+		one.others = nil
+		// The target is already resolved (and confirmed), and the tree
+		// was cleaned before the octopus attempt.
+		one.otherBranch = p.Target
+		one.commitDirty = false
+		one.deferPush = true
+		if err := runMerge(ctx, g, one, currentBranch, stdout); err != nil {
+			if rest := plans[i+1:]; len(rest) > 0 {
+				var names []string
+				for _, r := range rest {
+					names = append(names, r.Target)
+				}
+				fmt.Fprintf(stdout, "\nStopped at %s; still to merge: %s\n", p.Target, strings.Join(names, " "))
+			}
+			return err
+		}
+	}
+	if opts.deferPush {
+		return nil
+	}
+	if opts.noPush {
+		fmt.Fprintln(stdout, "skipping automatic push -- don't forget to push later")
+		return nil
+	}
+	return smartPush(ctx, g)
+}
+
+// mergeConflictError is returned by runMerge with opts.stopOnConflict when
+// the merge conflicts. The merge is left in progress and journaled.
+type mergeConflictError struct {
+	Target string
+	Paths  []string
+}
+
+func (e mergeConflictError) Error() string {
+	return fmt.Sprintf("mob-consensus: merging %s conflicts in %s (hint: resolve them with `mob-consensus merge --continue`, or give up with `mob-consensus merge --abort`)", e.Target, strings.Join(e.Paths, ", "))
+}
+
+// mergeTools resolves and checks the tools for a merge. With the built-in
+// review, difftool is not used.
+func mergeTools(ctx context.Context, g consensus.Git, mergeTool, diffTool string, noDiffTool, review bool) (consensus.Tools, error) {
+	repo := consensus.Runner{Git: g}
+	tools := repo.ResolveTools(ctx, consensus.ToolOverrides{
+		MergeTool:  mergeTool,
+		DiffTool:   diffTool,
+		NoDiffTool: noDiffTool,
+	})
+	if review {
+		// The built-in review replaces difftool.
+		tools.NoDiffTool = true
+	}
+	return tools, repo.CheckTools(ctx, tools)
+}
+
+// mayConflict reports whether merging any of targets into HEAD is predicted
+// to conflict. Without a prediction (git before 2.38) it assumes so.
+func mayConflict(ctx context.Context, repo consensus.Runner, targets []string) bool {
+	for _, target := range targets {
+		if p, err := repo.PredictMerge(ctx, target); err != nil || !p.Clean() {
+			return true
+		}
 	}
-	mergeHeadPath, err = filepath.Abs(mergeHeadPath)
+	return false
+}
+
+// finishMerge runs the steps of a journaled merge that haven't completed yet
+// (mergetool, assistant, review, commit, push), saving the journal after each
+// one. The journal is removed once the merge is committed and pushed.
+func finishMerge(ctx context.Context, g consensus.Git, j *consensus.MergeJournal, tools consensus.Tools, opts options, stdout io.Writer) error {
+	repo := consensus.Runner{Git: g}
+	msgPath, err := repo.MergeMessagePath(ctx)
 	if err != nil {
 		return err
 	}
 
-	mergeErr := gitRun(ctx, "merge", "--no-commit", "--no-ff", mergeTarget)
-	if mergeErr != nil {
-		if _, err := os.Stat(mergeHeadPath); err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				return mergeErr
+	if !j.Done(consensus.MergeStepResolved) {
+		unmerged, err := gitOutputTrimmed(ctx, g, "ls-files", "--unmerged")
+		if err != nil {
+			return err
+		}
+		if unmerged != "" {
+			if err := repo.CheckMergeTool(ctx, tools); err != nil {
+				return fmt.Errorf("%w (the merge is journaled; resume with mob-consensus merge --continue)", err)
 			}
+			if err := g.Run(ctx, "mergetool", "-t", tools.MergeTool); err != nil {
+				return err
+			}
+			unmerged, _ = gitOutputTrimmed(ctx, g, "ls-files", "--unmerged")
+			if unmerged != "" {
+				return errors.New("mob-consensus: unresolved merge conflicts remain after mergetool (hint: resolve them, then mob-consensus merge --continue)")
+			}
+		}
+		j.Mark(consensus.MergeStepResolved)
+		if err := repo.SaveMergeJournal(ctx, j); err != nil {
+			return err
+		}
+	}
+
+	if !j.Done(consensus.MergeStepDrafted) {
+		if !j.NoAssist && !opts.noAssist {
+			plan := consensus.MergePlan{Requested: j.Requested, Target: j.Target, Targets: j.Targets, CurrentBranch: j.CurrentBranch}
+			j.Message = string(assistMerge(ctx, g, plan, j.Conflicts, []byte(j.Message), stdout, opts.console.errOut()))
+		}
+		mergeMsgPath, err := repo.GitPath(ctx, "MERGE_MSG")
+		if err != nil {
 			return err
 		}
-		if err := gitRun(ctx, "mergetool", "-t", "vimdiff"); err != nil {
+		if err := os.WriteFile(mergeMsgPath, []byte(j.Message), 0o644); err != nil {
 			return err
 		}
-		unmerged, _ := gitOutputTrimmed(ctx, "ls-files", "--unmerged")
-		if unmerged != "" {
-			return errors.New("mob-consensus: unresolved merge conflicts remain after mergetool")
+		j.Mark(consensus.MergeStepDrafted)
+		if err := repo.SaveMergeJournal(ctx, j); err != nil {
+			return err
 		}
 	}
 
-	if _, err := os.Stat(mergeHeadPath); err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
+	if !j.Done(consensus.MergeStepReviewed) {
+		if j.Review {
+			if err := runReview(ctx, g, tools, opts, stdout); err != nil {
+				return err
+			}
+		} else if err := reviewMerge(ctx, g, tools, j.Conflicts, opts.console, stdout); err != nil {
+			return err
+		}
+		j.Mark(consensus.MergeStepReviewed)
+		if err := repo.SaveMergeJournal(ctx, j); err != nil {
+			return err
+		}
+	}
+
+	if !j.Done(consensus.MergeStepCommitted) {
+		if err := g.Run(ctx, tools.GitArgs("commit", "-e", "-F", msgPath)...); err != nil {
+			fmt.Fprintln(stdout, "don't forget to push")
+			return err
+		}
+		j.Mark(consensus.MergeStepCommitted)
+		if err := repo.SaveMergeJournal(ctx, j); err != nil {
+			return err
+		}
+	}
+
+	if opts.deferPush {
+		return repo.RemoveMergeJournal(ctx)
+	}
+	if j.NoPush || opts.noPush {
+		fmt.Fprintln(stdout, "skipping automatic push -- don't forget to push later")
+		return repo.RemoveMergeJournal(ctx)
+	}
+	if err := smartPush(ctx, g); err != nil {
+		return fmt.Errorf("%w (hint: the merge is committed; retry the push with mob-consensus merge --continue)", err)
+	}
+	return repo.RemoveMergeJournal(ctx)
+}
+
+// continueMerge resumes the journaled merge at its first unfinished step.
+func continueMerge(ctx context.Context, g consensus.Git, opts options, stdout io.Writer) error {
+	repo := consensus.Runner{Git: g}
+	j, err := repo.LoadMergeJournal(ctx)
+	if err != nil {
+		return err
+	}
+	if !j.Done(consensus.MergeStepCommitted) {
+		inProgress, err := mergeInProgress(ctx, g)
+		if err != nil {
+			return err
 		}
+		if !inProgress {
+			// The merge may have been committed with plain `git commit`;
+			// then only the push is left.
+			parents, _ := gitOutputTrimmed(ctx, g, "rev-parse", "HEAD^@")
+			if parents != strings.Join(append([]string{j.OrigHead}, j.TargetCommits...), "\n") {
+				return fmt.Errorf("mob-consensus: the merge of %s is no longer in progress (hint: mob-consensus merge --abort to discard the journal)", j.Target)
+			}
+			j.Mark(consensus.MergeStepCommitted)
+		}
+	}
+	fmt.Fprintf(stdout, "Continuing merge of %s onto %s.\n", j.Target, j.CurrentBranch)
+
+	review := j.Review || opts.review || opts.approve || !opts.console.interactive
+	tools, err := mergeTools(ctx, g, j.MergeTool, j.DiffTool, j.NoDiffTool, review)
+	if err != nil {
 		return err
 	}
+	j.Review = review
+	return finishMerge(ctx, g, j, tools, opts, stdout)
+}
+
+// mergeInProgress reports whether MERGE_HEAD exists.
+func mergeInProgress(ctx context.Context, g consensus.Git) (bool, error) {
+	path, err := consensus.Runner{Git: g}.GitPath(ctx, "MERGE_HEAD")
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
 
-	mergeMsgPath, err := gitOutputTrimmed(ctx, "rev-parse", "--git-path", "MERGE_MSG")
+// abortMerge undoes an uncommitted journaled merge (`git merge --abort`) and
+// removes the journal.
+func abortMerge(ctx context.Context, g consensus.Git, stdout io.Writer) error {
+	repo := consensus.Runner{Git: g}
+	j, err := repo.LoadMergeJournal(ctx)
 	if err != nil {
 		return err
 	}
-	mergeMsgPath, err = filepath.Abs(mergeMsgPath)
+	if j.Done(consensus.MergeStepCommitted) {
+		return fmt.Errorf("mob-consensus: the merge of %s is already committed (hint: mob-consensus merge --continue to push it, or undo it with `git reset --keep %s`)", j.Target, j.OrigHead)
+	}
+	inProgress, err := mergeInProgress(ctx, g)
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(mergeMsgPath, mergeMsg, 0o644); err != nil {
+	if inProgress {
+		if err := g.Run(ctx, "merge", "--abort"); err != nil {
+			return err
+		}
+	}
+	if err := repo.RemoveMergeJournal(ctx); err != nil {
 		return err
 	}
+	fmt.Fprintf(stdout, "Aborted merge of %s onto %s.\n", j.Target, j.CurrentBranch)
+	return nil
+}
 
-	if err := gitRun(ctx, "difftool", "-t", "vimdiff", "HEAD"); err != nil {
-		return err
+// reviewMerge runs the difftool review of the merge result.
+//
+// After a clean merge it opens difftool on everything. After conflicts it
+// prints a summary (diff --stat, resolved vs auto-merged files) and offers
+// difftool only for the auto-merged files, since the conflicted ones were just
+// reviewed in mergetool; "a" reviews everything instead.
+func reviewMerge(ctx context.Context, g consensus.Git, tools consensus.Tools, conflicted []string, con console, stdout io.Writer) error {
+	if len(conflicted) == 0 {
+		if tools.NoDiffTool {
+			return nil
+		}
+		return g.Run(ctx, "difftool", "-t", tools.DiffTool, "HEAD")
 	}
 
-	if err := gitRun(ctx, "commit", "-e", "-F", msgPath); err != nil {
-		fmt.Fprintln(stdout, "don't forget to push")
+	review, err := consensus.Runner{Git: g}.ReviewMerge(ctx, conflicted)
+	if err != nil {
 		return err
 	}
-
-	if opts.noPush {
-		fmt.Fprintln(stdout, "skipping automatic push -- don't forget to push later")
+	fmt.Fprintln(stdout, "Merge result vs HEAD:")
+	if review.Stat != "" {
+		fmt.Fprintln(stdout, review.Stat)
+	}
+	fmt.Fprintf(stdout, "Resolved conflicts (%d): %s\n", len(review.Resolved), strings.Join(review.Resolved, ", "))
+	if len(review.AutoMerged) > 0 {
+		fmt.Fprintf(stdout, "Auto-merged (%d): %s\n", len(review.AutoMerged), strings.Join(review.AutoMerged, ", "))
+	} else {
+		fmt.Fprintln(stdout, "Auto-merged (0)")
+	}
+	if tools.NoDiffTool {
 		return nil
 	}
-	return smartPush(ctx)
+
+	var paths []string
+	if len(review.AutoMerged) > 0 {
+		fmt.Fprintf(con.errOut(), "Review the %d auto-merged files in %s? [Y]es, [n]o, [a]ll files: ", len(review.AutoMerged), tools.DiffTool)
+		answer, err := promptString(con.in)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(answer) {
+		case "", "y", "yes":
+			paths = review.AutoMerged
+		case "a", "all":
+		default:
+			return nil
+		}
+	} else {
+		ok, err := confirm(con.in, con.errOut(), fmt.Sprintf("Only resolved files changed. Review everything in %s anyway? [y/N]: ", tools.DiffTool))
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	args := []string{"difftool", "-t", tools.DiffTool, "HEAD"}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	return g.Run(ctx, args...)
 }
 
 // ensureClean enforces a clean working tree before running an operation.
@@ -1256,8 +2213,8 @@ func runMerge(ctx context.Context, opts options, currentBranch string, stdout io
 // If requireClean is false, the function will print a warning but allow the
 // caller to continue. If opts.commitDirty is true, it will auto-commit dirty
 // changes (and push unless opts.noPush is set).
-func ensureClean(ctx context.Context, opts options, requireClean bool, stdout io.Writer) error {
-	status, err := gitOutputTrimmed(ctx, "status", "--porcelain")
+func ensureClean(ctx context.Context, g consensus.Git, opts options, requireClean bool, stdout io.Writer) error {
+	status, err := gitOutputTrimmed(ctx, g, "status", "--porcelain")
 	if err != nil {
 		return err
 	}
@@ -1273,135 +2230,68 @@ func ensureClean(ctx context.Context, opts options, requireClean bool, stdout io
 		return nil
 	}
 
-	if err := gitRun(ctx, "diff", "HEAD"); err != nil {
+	if err := g.Run(ctx, "diff", "HEAD"); err != nil {
 		return err
 	}
-	if err := gitRun(ctx, "commit", "-a"); err != nil {
+	tools := consensus.Runner{Git: g}.ResolveTools(ctx, consensus.ToolOverrides{})
+	if err := g.Run(ctx, tools.GitArgs("commit", "-a")...); err != nil {
 		return err
 	}
 	if opts.noPush {
 		return nil
 	}
-	return smartPush(ctx)
+	return smartPush(ctx, g)
 }
 
-// smartPush pushes the current branch.
-//
-// If an upstream is already configured, it runs `git push`. Otherwise it will
-// set an upstream with `git push -u <remote> <branch>` only when the remote is
-// unambiguous (branch.<name>.pushRemote, remote.pushDefault, or a sole remote).
-// If the remote choice is ambiguous it returns a clear error with exact
-// commands the user can run.
-func smartPush(ctx context.Context) error {
-	upstream, err := gitOutputTrimmed(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
-	if err == nil && upstream != "" {
-		return gitRun(ctx, "push")
-	}
-
-	currentBranch, err := gitOutputTrimmed(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+// smartPush pushes the current branch using the arguments selected by
+// consensus.Runner.PushArgs (the configured push remote, existing upstream,
+// branch.<name>.pushRemote, or a sole remote).
+func smartPush(ctx context.Context, g consensus.Git) error {
+	args, err := consensus.Runner{Git: g}.PushArgs(ctx)
 	if err != nil {
 		return err
 	}
-	if currentBranch == "" || currentBranch == "HEAD" {
-		return errors.New("mob-consensus: cannot push from detached HEAD")
-	}
-
-	branchPushRemote, err := gitOutputTrimmed(ctx, "config", "--get", "branch."+currentBranch+".pushRemote")
-	if err == nil && branchPushRemote != "" {
-		return gitRun(ctx, "push", "-u", branchPushRemote, currentBranch)
-	}
-
-	pushDefault, err := gitOutputTrimmed(ctx, "config", "--get", "remote.pushDefault")
-	if err == nil && pushDefault != "" {
-		return gitRun(ctx, "push", "-u", pushDefault, currentBranch)
-	}
-
-	remotesOut, err := gitOutputTrimmed(ctx, "remote")
-	if err != nil {
-		return fmt.Errorf("mob-consensus: cannot list git remotes: %w", err)
-	}
-
-	var remotes []string
-	for _, line := range strings.Split(remotesOut, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		remotes = append(remotes, line)
-	}
-
-	if len(remotes) == 0 {
-		return errors.New("mob-consensus: cannot push: no git remotes configured (hint: git remote -v)")
-	}
-	if len(remotes) == 1 {
-		return gitRun(ctx, "push", "-u", remotes[0], currentBranch)
+	if err := checkPushPolicy(ctx, g, args); err != nil {
+		return err
 	}
-
-	sort.Strings(remotes)
-	return fmt.Errorf(
-		"mob-consensus: cannot push: no upstream is set for branch %q and multiple remotes exist: %s (hint: git push -u <remote> %s; or: git config --local remote.pushDefault <remote>)",
-		currentBranch,
-		strings.Join(remotes, ", "),
-		currentBranch,
-	)
+	return g.Run(ctx, args...)
 }
 
-// resolveMergeTarget resolves a user-supplied merge target.
-//
-// If otherBranch is a valid local ref, it is returned as-is. Otherwise we try
-// to resolve it to exactly one "<remote>/<otherBranch>" among the configured
-// remotes. When a remote candidate is selected, needsConfirm is true so the UI
-// can ask the user to confirm the resolution.
-func resolveMergeTarget(ctx context.Context, otherBranch string) (string, bool, error) {
-	if _, err := gitOutput(ctx, "rev-parse", "--verify", otherBranch); err == nil {
-		return otherBranch, false, nil
-	}
-
-	remotesOut, err := gitOutputTrimmed(ctx, "remote")
-	if err != nil {
-		return "", false, branchNotFoundError{Branch: otherBranch}
-	}
+// console is the terminal a command talks to. The CLI connects it to the
+// command's stdin and stderr (see newConsole). The zero console has no input:
+// every prompt reads EOF and gets its default answer.
+type console struct {
+	// stdin is handed to editors as is; in buffers it for prompts, shared
+	// so that answers typed ahead aren't lost between prompts.
+	stdin io.Reader
+	in    *bufio.Reader
+	// stderr receives the prompts.
+	stderr io.Writer
+	// interactive is true when stdin is a terminal, which the review loop
+	// and the TUI require.
+	interactive bool
+}
 
-	var remotes []string
-	for _, line := range strings.Split(remotesOut, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		remotes = append(remotes, line)
-	}
-	if len(remotes) == 0 {
-		return "", false, branchNotFoundError{Branch: otherBranch}
-	}
+func newConsole(stdin io.Reader, stderr io.Writer) console {
+	f, ok := stdin.(*os.File)
+	return console{stdin: stdin, in: bufio.NewReader(stdin), stderr: stderr, interactive: ok && isTerminal(f)}
+}
 
-	var candidates []string
-	for _, remote := range remotes {
-		candidate := remote + "/" + otherBranch
-		if _, err := gitOutput(ctx, "rev-parse", "--verify", candidate); err == nil {
-			candidates = append(candidates, candidate)
-		}
-	}
-
-	switch len(candidates) {
-	case 1:
-		return candidates[0], true, nil
-	case 0:
-		return "", false, branchNotFoundError{Branch: otherBranch, Remotes: remotes}
-	default:
-		sort.Strings(candidates)
-		return "", false, fmt.Errorf(
-			"mob-consensus: branch %q is ambiguous; found multiple candidates: %s (use an explicit ref)",
-			otherBranch,
-			strings.Join(candidates, ", "),
-		)
+// errOut returns the console's stderr, or io.Discard for the zero console.
+func (c console) errOut() io.Writer {
+	if c.stderr == nil {
+		return io.Discard
 	}
+	return c.stderr
 }
 
 // promptString reads one line (up to '\n') from in and returns it trimmed. It's
-// used for interactive prompts.
-func promptString(in io.Reader) (string, error) {
-	reader := bufio.NewReader(in)
-	line, err := reader.ReadString('\n')
+// used for interactive prompts; a nil in reads as EOF.
+func promptString(in *bufio.Reader) (string, error) {
+	if in == nil {
+		return "", nil
+	}
+	line, err := in.ReadString('\n')
 	if err != nil && !errors.Is(err, io.EOF) {
 		return "", err
 	}
@@ -1410,14 +2300,12 @@ func promptString(in io.Reader) (string, error) {
 
 // confirm prints a prompt and reads a yes/no response from in.
 // Only "y" and "yes" (case-insensitive) are treated as confirmation.
-func confirm(in io.Reader, out io.Writer, prompt string) (bool, error) {
+func confirm(in *bufio.Reader, out io.Writer, prompt string) (bool, error) {
 	fmt.Fprint(out, prompt)
-	reader := bufio.NewReader(in)
-	line, err := reader.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
+	line, err := promptString(in)
+	if err != nil {
 		return false, err
 	}
-	line = strings.TrimSpace(line)
 	switch strings.ToLower(line) {
 	case "y", "yes":
 		return true, nil
@@ -1426,120 +2314,8 @@ func confirm(in io.Reader, out io.Writer, prompt string) (bool, error) {
 	}
 }
 
-// twigFromBranch extracts the twig from a branch name by taking the final path
-// element. Examples:
-//   - "alice/feature-x" => "feature-x"
-//   - "feature-x"       => "feature-x"
-func twigFromBranch(branch string) string {
-	return path.Base(strings.TrimSpace(branch))
-}
-
-// relatedBranches filters the output of `git branch -a` to branches that end in
-// "/<twig>". It ignores the current-branch marker "*" and symbolic-ref lines
-// like "remotes/origin/HEAD -> origin/main".
-func relatedBranches(branchAOutput, twig string) []string {
-	var out []string
-	for _, line := range strings.Split(branchAOutput, "\n") {
-		line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
-		if line == "" {
-			continue
-		}
-		if strings.Contains(line, "->") {
-			continue
-		}
-		if !strings.HasSuffix(line, "/"+twig) {
-			continue
-		}
-		out = append(out, line)
-	}
-	return out
-}
-
-// buildMergeMessage builds the merge commit message used by runMerge.
-//
-// It includes a stable subject line (used by tests and tooling) and a
-// deterministic set of `Co-authored-by:` trailers derived from commits in
-// HEAD..otherBranch (excluding the current user's email when available).
-func buildMergeMessage(ctx context.Context, otherBranch, currentBranch string) ([]byte, error) {
-	var buf strings.Builder
-	fmt.Fprintf(&buf, "mob-consensus merge from %s onto %s\n\n", otherBranch, currentBranch)
-
-	userEmail, err := gitOutputTrimmed(ctx, "config", "--get", "user.email")
-	if err != nil {
-		userEmail = ""
-	}
-	logOut, err := gitOutput(ctx, "log", ".."+otherBranch, "--pretty=format:Co-authored-by: %an <%ae>")
-	if err != nil {
-		return nil, err
-	}
-
-	coauthors := coAuthorLines(logOut, userEmail)
-	for _, line := range coauthors {
-		buf.WriteString(line)
-		buf.WriteString("\n")
-	}
-
-	return []byte(buf.String()), nil
-}
-
-// coAuthorLines parses `git log` output lines already formatted as
-// `Co-authored-by: ...` and returns a sorted, de-duplicated list, optionally
-// excluding lines containing excludeEmail.
-func coAuthorLines(gitLogOutput, excludeEmail string) []string {
-	seen := make(map[string]struct{})
-	for _, line := range strings.Split(gitLogOutput, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if excludeEmail != "" && strings.Contains(line, excludeEmail) {
-			continue
-		}
-		seen[line] = struct{}{}
-	}
-
-	out := make([]string, 0, len(seen))
-	for line := range seen {
-		out = append(out, line)
-	}
-	sort.Strings(out)
-	return out
-}
-
 // gitOutputTrimmed is gitOutput with surrounding whitespace trimmed.
-func gitOutputTrimmed(ctx context.Context, args ...string) (string, error) {
-	out, err := gitOutput(ctx, args...)
+func gitOutputTrimmed(ctx context.Context, g consensus.Git, args ...string) (string, error) {
+	out, err := g.Output(ctx, args...)
 	return strings.TrimSpace(out), err
 }
-
-// gitOutput runs `git <args...>` and returns stdout.
-//
-// It captures stderr for error messages. The command runs in the current
-// working directory; callers must ensure they have chdir'd into the target repo.
-func gitOutput(ctx context.Context, args ...string) (string, error) {
-	var stderr bytes.Buffer
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Stderr = &stderr
-	out, err := cmd.Output()
-	if err != nil {
-		msg := strings.TrimSpace(stderr.String())
-		if msg != "" {
-			return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, msg)
-		}
-		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
-	}
-	return string(out), nil
-}
-
-// gitRun runs `git <args...>` connected to the current process stdio. This is
-// used for interactive commands like commit/mergetool/difftool.
-func gitRun(ctx context.Context, args ...string) error {
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
-	}
-	return nil
-}
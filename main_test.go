@@ -6,11 +6,18 @@ package main
 // main_integration_test.go.
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/stevegt/mob-consensus/consensus"
 )
 
 // errReader is an io.Reader that always errors. It's used to exercise error
@@ -20,76 +27,6 @@ type errReader struct{}
 // Read always returns an error.
 func (errReader) Read([]byte) (int, error) { return 0, errors.New("boom") }
 
-// TestTwigFromBranch verifies that twig extraction is stable for both local and
-// remote-tracking branch name formats.
-func TestTwigFromBranch(t *testing.T) {
-	t.Parallel()
-
-	tests := []struct {
-		branch string
-		want   string
-	}{
-		{branch: "stevegt/foo", want: "foo"},
-		{branch: "remotes/origin/stevegt/foo", want: "foo"},
-		{branch: "foo", want: "foo"},
-		{branch: " foo \n", want: "foo"},
-	}
-	for _, tt := range tests {
-		got := twigFromBranch(tt.branch)
-		if got != tt.want {
-			t.Fatalf("twigFromBranch(%q)=%q, want %q", tt.branch, got, tt.want)
-		}
-	}
-}
-
-// TestRelatedBranches verifies that `relatedBranches` filters branches ending
-// in "/<twig>" and ignores symbolic-ref and current-branch markers.
-func TestRelatedBranches(t *testing.T) {
-	t.Parallel()
-
-	in := strings.Join([]string{
-		"* stevegt/twig",
-		"  alice/twig",
-		"  remotes/origin/alice/twig",
-		"  remotes/origin/HEAD -> origin/master",
-		"  remotes/origin/stevegt/other",
-		"",
-	}, "\n")
-
-	got := relatedBranches(in, "twig")
-	want := []string{
-		"stevegt/twig",
-		"alice/twig",
-		"remotes/origin/alice/twig",
-	}
-	if strings.Join(got, "\n") != strings.Join(want, "\n") {
-		t.Fatalf("relatedBranches()=%q, want %q", got, want)
-	}
-}
-
-// TestCoAuthorLines verifies stable sorting/deduping and "exclude self" logic
-// for Co-authored-by trailers.
-func TestCoAuthorLines(t *testing.T) {
-	t.Parallel()
-
-	in := strings.Join([]string{
-		"Co-authored-by: Zed <zed@example.com>",
-		"Co-authored-by: Me <me@example.com>",
-		"Co-authored-by: Alice <alice@example.com>",
-		"Co-authored-by: Alice <alice@example.com>",
-		"",
-	}, "\n")
-
-	got := coAuthorLines(in, "me@example.com")
-	want := []string{
-		"Co-authored-by: Alice <alice@example.com>",
-		"Co-authored-by: Zed <zed@example.com>",
-	}
-	if strings.Join(got, "\n") != strings.Join(want, "\n") {
-		t.Fatalf("coAuthorLines()=%q, want %q", got, want)
-	}
-}
-
 // TestDiffStatusLine checks the formatting logic for ahead/behind/diverged
 // status lines.
 func TestDiffStatusLine(t *testing.T) {
@@ -141,6 +78,23 @@ func TestValidateOnboardingFlags(t *testing.T) {
 	}
 }
 
+// TestValidateStatusFormat checks accepted formats and the -c conflict.
+func TestValidateStatusFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{formatText, formatJSON, formatNDJSON} {
+		if err := validateStatusFormat(options{format: format}); err != nil {
+			t.Fatalf("validateStatusFormat(%q) err=%v", format, err)
+		}
+	}
+	if err := validateStatusFormat(options{format: "yaml"}); err == nil {
+		t.Fatalf("validateStatusFormat(yaml) err=nil, want error")
+	}
+	if err := validateStatusFormat(options{format: formatJSON, commitDirty: true}); err == nil {
+		t.Fatalf("validateStatusFormat(json, -c) err=nil, want error")
+	}
+}
+
 // TestConfirm exercises yes/no prompt parsing, including EOF without newline.
 func TestConfirm(t *testing.T) {
 	t.Parallel()
@@ -161,7 +115,7 @@ func TestConfirm(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got, err := confirm(strings.NewReader(tt.in), io.Discard, "prompt: ")
+		got, err := confirm(bufio.NewReader(strings.NewReader(tt.in)), io.Discard, "prompt: ")
 		if err != nil {
 			t.Fatalf("confirm() err=%v", err)
 		}
@@ -201,13 +155,13 @@ func TestPrintErrorNil(t *testing.T) {
 func TestRequireUserBranch(t *testing.T) {
 	t.Parallel()
 
-	if err := requireUserBranch(true, "alice", "main"); err != nil {
+	if err := requireUserBranch(true, consensus.Naming{}, "alice", "main"); err != nil {
 		t.Fatalf("requireUserBranch(force=true) err=%v, want nil", err)
 	}
-	if err := requireUserBranch(false, "alice", "alice/feature-x"); err != nil {
+	if err := requireUserBranch(false, consensus.Naming{}, "alice", "alice/feature-x"); err != nil {
 		t.Fatalf("requireUserBranch(on user branch) err=%v, want nil", err)
 	}
-	if err := requireUserBranch(false, "alice", "bob/feature-x"); err == nil {
+	if err := requireUserBranch(false, consensus.Naming{}, "alice", "bob/feature-x"); err == nil {
 		t.Fatalf("requireUserBranch(on non-user branch) err=nil, want error")
 	}
 }
@@ -216,7 +170,151 @@ func TestRequireUserBranch(t *testing.T) {
 func TestPromptStringError(t *testing.T) {
 	t.Parallel()
 
-	if _, err := promptString(errReader{}); err == nil {
+	if _, err := promptString(bufio.NewReader(errReader{})); err == nil {
 		t.Fatalf("promptString(errReader) err=nil, want error")
 	}
 }
+
+// TestFormatAge checks the coarse age buckets used by `claims`.
+func TestFormatAge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: -time.Second, want: "0s"},
+		{d: 45 * time.Second, want: "45s"},
+		{d: 12 * time.Minute, want: "12m"},
+		{d: 30 * time.Hour, want: "30h"},
+		{d: 5 * 24 * time.Hour, want: "5d"},
+	}
+	for _, tt := range tests {
+		if got := formatAge(tt.d); got != tt.want {
+			t.Fatalf("formatAge(%v)=%q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// TestPrintPlan numbers the steps and marks the ones already done.
+func TestPrintPlan(t *testing.T) {
+	t.Parallel()
+
+	var out strings.Builder
+	printPlan(&out, "mob-consensus join (twig=feature-x, remote=origin, user=alice)", []plannedStep{
+		{Explain: "Fetch remote refs from origin", Lines: []string{"git fetch origin"}},
+		{Explain: `Push your personal branch "alice/feature-x"`, Done: true, Lines: []string{"(already done: pushed)"}},
+	})
+	want := "mob-consensus join (twig=feature-x, remote=origin, user=alice)\n" +
+		"  1) Fetch remote refs from origin\n" +
+		"       git fetch origin\n" +
+		"  2) [done] Push your personal branch \"alice/feature-x\"\n" +
+		"       (already done: pushed)\n"
+	if out.String() != want {
+		t.Fatalf("printPlan=\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+// TestTUIModelTransitions drives the Bubble Tea model with messages and keys,
+// without a terminal or git.
+func TestTUIModelTransitions(t *testing.T) {
+	t.Parallel()
+
+	key := func(s string) tea.KeyMsg {
+		switch s {
+		case "down":
+			return tea.KeyMsg{Type: tea.KeyDown}
+		case "enter":
+			return tea.KeyMsg{Type: tea.KeyEnter}
+		case "tab":
+			return tea.KeyMsg{Type: tea.KeyTab}
+		case "right":
+			return tea.KeyMsg{Type: tea.KeyRight}
+		case "esc":
+			return tea.KeyMsg{Type: tea.KeyEsc}
+		}
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+	}
+	update := func(m tuiModel, msg tea.Msg) (tuiModel, tea.Cmd) {
+		next, cmd := m.Update(msg)
+		return next.(tuiModel), cmd
+	}
+
+	m := newTUIModel(context.Background(), nil, options{}, "alice", io.Discard)
+	if !strings.Contains(m.View(), "Loading") {
+		t.Fatalf("expected loading view:\n%s", m.View())
+	}
+	m, _ = update(m, discoveryMsg{d: consensus.Discovery{
+		CurrentBranch: "alice/twig",
+		Twig:          "twig",
+		Branches: []consensus.BranchStatus{
+			{Branch: "bob/twig", Ahead: "1 file changed", AheadCommits: 1},
+			{Branch: "remotes/origin/carol/twig", Ahead: "1 file changed", Behind: "2 files changed", AheadCommits: 1, BehindCommits: 3},
+			{Branch: "dave/twig", Behind: "1 file changed", BehindCommits: 1},
+		},
+	}})
+	view := m.View()
+	for _, want := range []string{"> bob/twig", "[ahead]", "remotes/origin/carol/twig", "[diverged]", "+1/-3", "enter merge"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("expected %q in view:\n%s", want, view)
+		}
+	}
+
+	m, _ = update(m, key("down"))
+	if m.cursor != 1 || !strings.Contains(m.View(), "> remotes/origin/carol/twig") {
+		t.Fatalf("expected the cursor on carol, cursor=%d:\n%s", m.cursor, m.View())
+	}
+	if _, cmd := update(m, key("enter")); cmd == nil {
+		t.Fatalf("expected enter to start a merge")
+	}
+
+	// A branch we are ahead of has nothing to merge.
+	onDave, _ := update(m, key("down"))
+	onDave, _ = update(onDave, key("down"))
+	if onDave.cursor != 2 {
+		t.Fatalf("expected the cursor to stop on the last branch, cursor=%d", onDave.cursor)
+	}
+	if strings.Contains(onDave.View(), "enter merge") {
+		t.Fatalf("expected no merge offer for a behind branch:\n%s", onDave.View())
+	}
+	if onDave, cmd := update(onDave, key("enter")); cmd != nil || !strings.Contains(onDave.status, "Nothing to merge: dave/twig is behind") {
+		t.Fatalf("expected enter on a behind branch to do nothing, status=%q", onDave.status)
+	}
+
+	// Merging requires a <user>/ branch unless -F is set.
+	onMain := m
+	onMain.disc.CurrentBranch = "main"
+	onMain, cmd := update(onMain, key("enter"))
+	if cmd != nil || onMain.err == nil || !strings.Contains(onMain.View(), "main") {
+		t.Fatalf("expected a <user>/ branch error, err=%v", onMain.err)
+	}
+
+	m, _ = update(m, key("w"))
+	m, _ = update(m, key("right"))
+	m, _ = update(m, key("tab"))
+	for _, r := range "feature-x" {
+		m, _ = update(m, key(string(r)))
+	}
+	view = m.View()
+	if m.view != tuiWizard || !strings.Contains(view, "< start >") || !strings.Contains(view, "Twig:   feature-x_") {
+		t.Fatalf("unexpected wizard view:\n%s", view)
+	}
+	if got := m.wizardOptions(); got.twig != "feature-x" || got.base != "" {
+		t.Fatalf("wizardOptions()=%+v", got)
+	}
+	m, cmd = update(m, key("enter"))
+	if cmd == nil || !m.wizard.stale {
+		t.Fatalf("expected enter to request a preview")
+	}
+	m, _ = update(m, wizardPlanMsg{title: "mob-consensus start", steps: []plannedStep{{Explain: "Fetch", Lines: []string{"git fetch origin"}}}})
+	if view := m.View(); !strings.Contains(view, "1) Fetch") || !strings.Contains(view, "git fetch origin") || !strings.Contains(view, "run these steps") {
+		t.Fatalf("expected previewed steps:\n%s", view)
+	}
+	if _, cmd := update(m, key("enter")); cmd == nil {
+		t.Fatalf("expected enter to run the previewed steps")
+	}
+	m, _ = update(m, key("esc"))
+	if m.view != tuiBranches {
+		t.Fatalf("expected esc to return to the branch table")
+	}
+}
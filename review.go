@@ -0,0 +1,203 @@
+package main
+
+// Built-in merge review and the optional merge assistant (TODO 012).
+//
+// `merge --review` (or mob-consensus.review=true) replaces the difftool step
+// with a loop over the staged merge result, file by file and hunk by hunk.
+// Every hunk must be approved (possibly after editing the file or reverting
+// hunks) before the merge is committed. Without a terminal the change set is
+// printed instead and the merge is only committed with --approve, so an agent
+// can't slip changes through unreviewed; until then it stays in progress, so
+// the agent can approve what it read with `merge --continue --approve`. This
+// gate applies to every merge without a terminal, with or without --review.
+// --approve is an explicit decision and skips the loop on a terminal too.
+//
+// A configured assistant (mob-consensus.assistCommand) may draft a summary and
+// a message body first. The draft only lands in the merge message, which still
+// goes through the editor and this review.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+
+	"github.com/stevegt/mob-consensus/consensus"
+)
+
+// isTerminal reports whether f is a terminal (including Cygwin/MSYS ptys).
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// errReviewAborted is returned when the user quits the review loop.
+var errReviewAborted = errors.New("mob-consensus: review aborted; nothing was committed (hint: the merge is still in progress; resume it with `mob-consensus merge --continue` or discard it with `mob-consensus merge --abort`)")
+
+// reviewEnabled reports whether `merge` should run the built-in review
+// instead of difftool. Without a terminal it always does, so the change set
+// is printed and needs --approve.
+func reviewEnabled(ctx context.Context, g consensus.Git, opts options) bool {
+	if opts.review || opts.approve || !opts.console.interactive {
+		return true
+	}
+	v, _ := gitOutputTrimmed(ctx, g, "config", "--bool", "--get", consensus.ConfigReview)
+	return v == "true"
+}
+
+// runReview gates the merge commit on approval of every staged change. It
+// returns nil only when everything was approved.
+func runReview(ctx context.Context, g consensus.Git, tools consensus.Tools, opts options, stdout io.Writer) error {
+	repo := consensus.Runner{Git: g}
+	files, err := repo.StagedChanges(ctx)
+	if err != nil {
+		return err
+	}
+
+	if opts.approve || !opts.console.interactive {
+		stat, err := gitOutputTrimmed(ctx, g, "diff", "--cached", "--stat", "HEAD")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Change set to commit (%d files):\n%s\n\n", len(files), stat)
+		for _, f := range files {
+			fmt.Fprint(stdout, f.Header)
+			for _, h := range f.Hunks {
+				fmt.Fprint(stdout, h.Text)
+			}
+		}
+		if opts.approve {
+			fmt.Fprintln(stdout, "Approved with --approve.")
+			return nil
+		}
+		// Keep the merge and its journal: the caller approves exactly the
+		// change set it just read by resuming.
+		return errors.New("mob-consensus: the merge needs approval and stdin is not a terminal; review the change set above, then approve it with `mob-consensus merge --continue --approve` (nothing was committed; the merge is still in progress; `mob-consensus merge --abort` discards it)")
+	}
+
+	fmt.Fprintf(stdout, "Reviewing %d files; approve every hunk to commit the merge.\n", len(files))
+	for i, f := range files {
+		if err := reviewFile(ctx, g, tools, opts.console, f.Path, fmt.Sprintf("[%d/%d]", i+1, len(files)), stdout); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(stdout, "All %d files approved.\n", len(files))
+	return nil
+}
+
+// reviewFile walks the hunks of one staged file. Reverting a hunk re-reads
+// the file's diff and continues with the next hunk; editing the file restarts
+// its review, since any hunk may have changed.
+func reviewFile(ctx context.Context, g consensus.Git, tools consensus.Tools, con console, path, progress string, stdout io.Writer) error {
+	repo := consensus.Runner{Git: g}
+	for i := 0; ; {
+		files, err := repo.StagedChanges(ctx, path)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			fmt.Fprintf(stdout, "%s %s: no changes left\n", progress, path)
+			return nil
+		}
+		f := files[0]
+
+		// Files without hunks (binary, mode-only) are reviewed as a whole.
+		units := len(f.Hunks)
+		if units == 0 {
+			units = 1
+		}
+		if i >= units {
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "\n%s %s, hunk %d/%d\n", progress, path, i+1, units)
+		actions := "[a]pprove, [e]dit file, [q]uit"
+		if len(f.Hunks) == 0 {
+			fmt.Fprint(stdout, f.Header)
+		} else {
+			fmt.Fprint(stdout, f.Hunks[i].Text)
+			actions = "[a]pprove, [e]dit file, [r]evert hunk, [q]uit"
+		}
+		fmt.Fprintf(con.errOut(), "%s? ", actions)
+
+		answer, err := con.in.ReadString('\n')
+		if errors.Is(err, io.EOF) && answer == "" {
+			return errReviewAborted
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "a", "approve":
+			i++
+		case "r", "revert":
+			if len(f.Hunks) == 0 {
+				continue
+			}
+			if err := repo.RevertHunk(ctx, f, f.Hunks[i]); err != nil {
+				return err
+			}
+		case "e", "edit":
+			if err := editStagedFile(ctx, g, tools, con, path, stdout); err != nil {
+				return err
+			}
+			i = 0
+		case "q", "quit", "abort":
+			return errReviewAborted
+		}
+	}
+}
+
+// editStagedFile opens path (relative to the top of the working tree) in the
+// commit editor, on the console, and stages the result.
+func editStagedFile(ctx context.Context, g consensus.Git, tools consensus.Tools, con console, path string, stdout io.Writer) error {
+	top, err := gitOutputTrimmed(ctx, g, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	editor, err := gitOutputTrimmed(ctx, g, tools.GitArgs("var", "GIT_EDITOR")...)
+	if err != nil {
+		return err
+	}
+	// Run the editor the way git does: through the shell, with the file as
+	// its argument.
+	cmd := exec.CommandContext(ctx, "sh", "-c", editor+` "$@"`, editor, filepath.Join(top, path))
+	cmd.Dir = top
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = con.stdin, stdout, con.stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mob-consensus: editor %q failed: %w", editor, err)
+	}
+	_, err = g.Output(ctx, "-C", top, "add", "--", path)
+	return err
+}
+
+// assistMerge asks the configured assistant, if any, to summarize the merge
+// and draft a message body, and returns msg with the draft in it. Failures
+// are warnings: the assistant is optional, and the plain message still works.
+func assistMerge(ctx context.Context, g consensus.Git, plan consensus.MergePlan, conflicted []string, msg []byte, stdout, stderr io.Writer) []byte {
+	repo := consensus.Runner{Git: g}
+	assistant := repo.ConfiguredAssistant(ctx)
+	if assistant == nil {
+		return msg
+	}
+	req, err := repo.AssistRequest(ctx, plan, conflicted)
+	if err == nil {
+		var resp consensus.AssistResponse
+		if resp, err = assistant.Assist(ctx, req); err == nil {
+			if resp.Summary != "" {
+				fmt.Fprintf(stdout, "Assistant summary (a draft; check it against the diff):\n%s\n\n", resp.Summary)
+			}
+			if resp.Body != "" {
+				fmt.Fprintln(stdout, "The assistant drafted the merge message body; edit it before committing.")
+			}
+			return consensus.DraftMergeMessage(msg, resp.Body)
+		}
+	}
+	fmt.Fprintf(stderr, "warning: %v (continuing without the assistant)\n", err)
+	return msg
+}
@@ -0,0 +1,133 @@
+package main
+
+// `mob-consensus sync`: converge with every peer in one session.
+//
+// sync runs `status`-style discovery, then merges each peer that has changes
+// we lack through the regular `merge` flow (tools, review, assistant,
+// journal), one at a time, and pushes once at the end. It keeps no state of
+// its own: every round re-runs discovery, so after a conflict is resolved
+// with `merge --continue`, re-running sync picks up the remaining peers.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/stevegt/mob-consensus/consensus"
+)
+
+// runSync implements `mob-consensus sync`.
+func runSync(ctx context.Context, g consensus.Git, opts options, currentBranch string, stdout io.Writer) error {
+	repo := consensus.Runner{Git: g}
+	if _, err := repo.LoadMergeJournal(ctx); err == nil {
+		return errors.New("mob-consensus: a mob-consensus merge is in progress (hint: finish it with `mob-consensus merge --continue` or `mob-consensus merge --abort`, then re-run `mob-consensus sync`)")
+	} else if !errors.Is(err, consensus.ErrNoMergeJournal) {
+		return err
+	}
+
+	filter := consensus.SyncFilter{Only: opts.only, Skip: opts.skip}
+	d, err := repo.Discover(ctx, currentBranch)
+	if err != nil {
+		return err
+	}
+	var filtered []string
+	for _, b := range d.Branches {
+		if b.NeedsMerge() && !filter.Allows(b) {
+			filtered = append(filtered, b.Branch)
+		}
+	}
+
+	// Each merge runs without its own push; sync pushes once at the end.
+	mergeOpts := opts
+	mergeOpts.deferPush = true
+	mergeOpts.stopOnConflict = true
+
+	var merged []string
+	tried := map[string]bool{}
+	var syncErr error
+	for {
+		b, ok := consensus.NextSyncTarget(d, filter, tried)
+		if !ok {
+			break
+		}
+		tried[b.Branch] = true
+
+		fmt.Fprintf(stdout, "\n== Merging %s (%s, %s) ==\n", b.Branch, b.State(), countNoun(b.AheadCommits, "commit"))
+		before, err := gitOutputTrimmed(ctx, g, "rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		mergeOpts.otherBranch = b.MergeRef()
+		if syncErr = runMerge(ctx, g, mergeOpts, currentBranch, stdout); syncErr != nil {
+			break
+		}
+		// Only -c auto-commits the dirty tree, and only before the first
+		// merge.
+		mergeOpts.commitDirty = false
+		after, err := gitOutputTrimmed(ctx, g, "rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		if after != before {
+			merged = append(merged, fmt.Sprintf("%s (%s)", b.Branch, countNoun(b.AheadCommits, "commit")))
+		}
+
+		if d, err = repo.Discover(ctx, currentBranch); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(stdout, "\nSync summary for %s:\n", currentBranch)
+	fmt.Fprintf(stdout, "  merged (%d): %s\n", len(merged), listOrNone(merged))
+	if len(filtered) > 0 {
+		fmt.Fprintf(stdout, "  filtered out (%d): %s\n", len(filtered), strings.Join(filtered, ", "))
+	}
+	if syncErr != nil {
+		var conflict mergeConflictError
+		if errors.As(syncErr, &conflict) {
+			fmt.Fprintf(stdout, "  stopped at %s: conflicts in %s\n", conflict.Target, strings.Join(conflict.Paths, ", "))
+			fmt.Fprintln(stdout, "  resolve with `mob-consensus merge --continue`, then re-run `mob-consensus sync` for the rest")
+		} else {
+			fmt.Fprintf(stdout, "  stopped at %s\n", mergeOpts.otherBranch)
+		}
+		if len(merged) > 0 {
+			fmt.Fprintln(stdout, "  the merges above are committed but not pushed")
+		}
+		return syncErr
+	}
+
+	if opts.noPush {
+		fmt.Fprintln(stdout, "skipping automatic push -- don't forget to push later")
+		return nil
+	}
+	if len(merged) == 0 && !unpushed(ctx, g) {
+		fmt.Fprintln(stdout, "Nothing to push.")
+		return nil
+	}
+	return smartPush(ctx, g)
+}
+
+// unpushed reports whether HEAD has commits its upstream lacks, or has no
+// upstream yet.
+func unpushed(ctx context.Context, g consensus.Git) bool {
+	count, err := gitOutputTrimmed(ctx, g, "rev-list", "--count", "@{u}..HEAD")
+	return err != nil || count != "0"
+}
+
+// listOrNone joins items with ", ", or returns "none".
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// countNoun formats n with noun, pluralized with "s" unless n is 1.
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,54 @@
+package main
+
+// Repo-tracked collaborator roster (TODO 008).
+//
+// `.mob-consensus.toml` lists each collaborator's <user> label and fork URL.
+// `mob-consensus team sync` turns it into local git remotes (with the default
+// fetch refspec) and points remote.pushDefault at your own fork, so nobody has
+// to hand-type `git remote add` for every peer. `join` runs the same sync once
+// the roster is checked out.
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/stevegt/mob-consensus/consensus"
+)
+
+// runTeamSync implements `mob-consensus team sync`. The roster entries are
+// turned into a git plan, so --plan/--dry-run/--yes behave like onboarding.
+func runTeamSync(ctx context.Context, g consensus.Git, opts options, user string, stdout, stderr io.Writer) error {
+	repo := consensus.Runner{Git: g}
+	team, ok, err := repo.LoadTeam(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("mob-consensus: no %s in this repo (hint: commit one listing each collaborator's user and fork url)", consensus.TeamFile)
+	}
+
+	steps, err := repo.TeamSync(ctx, team, user)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		if !opts.dryRun {
+			fmt.Fprintf(stdout, "Remotes already match %s (%d collaborators).\n", consensus.TeamFile, len(team.Collaborators))
+		}
+		return nil
+	}
+
+	var plan []gitPlanStep
+	for _, step := range steps {
+		args := step.Args
+		plan = append(plan, gitPlanStep{
+			Explain: step.Explain,
+			Args: func(ctx context.Context) ([]string, error) {
+				return args, nil
+			},
+		})
+	}
+	title := fmt.Sprintf("mob-consensus team sync (%s, user=%s)", consensus.TeamFile, user)
+	return runGitPlan(ctx, g, opts, title, plan, stdout, stderr)
+}
@@ -0,0 +1,503 @@
+package main
+
+// Optional Bubble Tea front-end (TODO 014).
+//
+// `mob-consensus tui` shows the related-branch table from the same
+// consensus.Discover data as `status`, refreshed live, and merges the selected
+// peer with the regular merge flow. `w` opens an onboarding wizard that lists
+// the init/start/join steps (the same steps their --plan shows) before
+// running them. Anything that needs the terminal (merge tools, editors, per-step
+// confirmations) runs with the TUI suspended and returns to it afterwards.
+//
+// The TUI refuses to start without a terminal; scripts keep using the plain
+// commands, whose --plan/--dry-run/--yes behavior is unchanged.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/stevegt/mob-consensus/consensus"
+)
+
+// tuiRefreshInterval is how often the branch table re-reads local refs.
+// Remote refs only change with `f` (fetch), like `status`.
+const tuiRefreshInterval = 5 * time.Second
+
+// runTUI implements `mob-consensus tui`. It draws on stdout and reads keys
+// from the console's stdin.
+func runTUI(ctx context.Context, g consensus.Git, opts options, user string, stdout io.Writer) error {
+	if f, ok := stdout.(*os.File); !ok || !isTerminal(f) || !opts.console.interactive {
+		return errors.New("mob-consensus: tui needs a terminal on stdin and stdout (hint: scripts should use status, merge, and init/start/join with --plan, --dry-run, or --yes)")
+	}
+	_, err := tea.NewProgram(newTUIModel(ctx, g, opts, user, stdout), tea.WithAltScreen(), tea.WithContext(ctx), tea.WithInput(opts.console.stdin), tea.WithOutput(stdout)).Run()
+	return err
+}
+
+type tuiView int
+
+const (
+	tuiBranches tuiView = iota
+	tuiWizard
+)
+
+// Messages delivered to tuiModel.Update by its commands.
+type (
+	discoveryMsg struct {
+		d   consensus.Discovery
+		err error
+	}
+	fetchedMsg     struct{ err error }
+	refreshTickMsg struct{}
+	execDoneMsg    struct {
+		what string
+		err  error
+	}
+	wizardPlanMsg struct {
+		title string
+		steps []plannedStep
+		err   error
+	}
+)
+
+// wizardFlows are the onboarding commands the wizard can run.
+var wizardFlows = []command{cmdInit, cmdStart, cmdJoin}
+
+// wizardFields are the wizard's inputs, in tab order.
+var wizardFields = []string{"Flow", "Twig", "Base", "Remote"}
+
+// wizardModel is the onboarding wizard's state.
+type wizardModel struct {
+	flow  int
+	field int
+	// values holds the text inputs, indexed like wizardFields (values[0] is
+	// unused; the flow is picked with ←/→).
+	values [4]string
+
+	// title and steps are the previewed plan; stale is true when the
+	// inputs changed since the preview.
+	title string
+	steps []plannedStep
+	stale bool
+	err   error
+}
+
+// tuiModel is the Bubble Tea model behind `mob-consensus tui`.
+type tuiModel struct {
+	ctx  context.Context
+	g    consensus.Git
+	opts options
+	user string
+	// stdout is the terminal suspended commands write to; prompts and
+	// errors go to the console in opts.
+	stdout io.Writer
+
+	view   tuiView
+	disc   consensus.Discovery
+	loaded bool
+	cursor int
+	status string
+	err    error
+
+	wizard wizardModel
+}
+
+func newTUIModel(ctx context.Context, g consensus.Git, opts options, user string, stdout io.Writer) tuiModel {
+	return tuiModel{ctx: ctx, g: g, opts: opts, user: user, stdout: stdout, wizard: wizardModel{stale: true}}
+}
+
+// Init implements tea.Model.
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.discover(), refreshTick())
+}
+
+func refreshTick() tea.Cmd {
+	return tea.Tick(tuiRefreshInterval, func(time.Time) tea.Msg { return refreshTickMsg{} })
+}
+
+// discover re-reads the current branch and its related branches.
+func (m tuiModel) discover() tea.Cmd {
+	return func() tea.Msg {
+		currentBranch, err := gitOutputTrimmed(m.ctx, m.g, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return discoveryMsg{err: err}
+		}
+		d, err := consensus.Runner{Git: m.g}.Discover(m.ctx, currentBranch)
+		return discoveryMsg{d: d, err: err}
+	}
+}
+
+// fetch fetches the same remotes as `status`, capturing git's output so it
+// doesn't draw over the TUI.
+func (m tuiModel) fetch() tea.Cmd {
+	return func() tea.Msg {
+		remotes, err := consensus.Runner{Git: m.g}.FetchRemotes(m.ctx, "")
+		if err != nil {
+			return fetchedMsg{err: err}
+		}
+		for _, remote := range remotes {
+			if _, err := m.g.Output(m.ctx, "fetch", remote); err != nil {
+				return fetchedMsg{err: err}
+			}
+		}
+		return fetchedMsg{}
+	}
+}
+
+// Update implements tea.Model.
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case discoveryMsg:
+		m.loaded = true
+		m.err = msg.err
+		if msg.err == nil {
+			m.disc = msg.d
+			if m.cursor >= len(m.disc.Branches) {
+				m.cursor = max(len(m.disc.Branches)-1, 0)
+			}
+		}
+		return m, nil
+	case fetchedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.status = "Fetched."
+		return m, m.discover()
+	case refreshTickMsg:
+		if m.view == tuiBranches {
+			return m, tea.Batch(m.discover(), refreshTick())
+		}
+		return m, refreshTick()
+	case execDoneMsg:
+		m.err = msg.err
+		m.status = ""
+		if msg.err == nil {
+			m.status = msg.what + " finished."
+		}
+		m.wizard.stale = true
+		return m, m.discover()
+	case wizardPlanMsg:
+		m.wizard.title, m.wizard.steps, m.wizard.err = msg.title, msg.steps, msg.err
+		m.wizard.stale = msg.err != nil
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.view == tuiWizard {
+			return m.updateWizard(msg)
+		}
+		return m.updateBranches(msg)
+	}
+	return m, nil
+}
+
+func (m tuiModel) updateBranches(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.disc.Branches)-1 {
+			m.cursor++
+		}
+	case "r":
+		m.status = "Refreshing..."
+		return m, m.discover()
+	case "f":
+		m.status = "Fetching..."
+		return m, m.fetch()
+	case "w":
+		m.view = tuiWizard
+		m.err = nil
+	case "enter", "m":
+		if len(m.disc.Branches) == 0 {
+			m.status = "No related branch to merge."
+			return m, nil
+		}
+		if err := requireUserBranch(m.opts.force, m.disc.Naming, m.user, m.disc.CurrentBranch); err != nil {
+			m.err = err
+			return m, nil
+		}
+		branch := m.disc.Branches[m.cursor]
+		if !branch.NeedsMerge() {
+			m.status = fmt.Sprintf("Nothing to merge: %s is %s.", branch.Branch, branch.State())
+			return m, nil
+		}
+		target := branch.MergeRef()
+		opts := m.opts
+		opts.otherBranch = target
+		currentBranch := m.disc.CurrentBranch
+		return m, m.suspend("merge "+target, func() error {
+			if _, err := fetchRelated(m.ctx, m.g, opts, target, opts.console.errOut()); err != nil {
+				return err
+			}
+			return runMerge(m.ctx, m.g, opts, currentBranch, m.stdout)
+		})
+	}
+	return m, nil
+}
+
+func (m tuiModel) updateWizard(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	w := &m.wizard
+	switch key := msg.String(); key {
+	case "esc":
+		m.view = tuiBranches
+		return m, m.discover()
+	case "tab", "down":
+		w.field = (w.field + 1) % len(wizardFields)
+	case "shift+tab", "up":
+		w.field = (w.field + len(wizardFields) - 1) % len(wizardFields)
+	case "left", "right":
+		if w.field == 0 {
+			step := 1
+			if key == "left" {
+				step = len(wizardFlows) - 1
+			}
+			w.flow = (w.flow + step) % len(wizardFlows)
+			w.stale = true
+		}
+	case "backspace":
+		if w.field > 0 && w.values[w.field] != "" {
+			v := []rune(w.values[w.field])
+			w.values[w.field] = string(v[:len(v)-1])
+			w.stale = true
+		}
+	case "enter":
+		opts := m.wizardOptions()
+		flow := wizardFlows[w.flow]
+		if w.stale {
+			w.err = nil
+			return m, func() tea.Msg {
+				title, steps, err := wizardPlan(m.ctx, m.g, flow, opts, m.user, m.disc.CurrentBranch)
+				return wizardPlanMsg{title: title, steps: steps, err: err}
+			}
+		}
+		currentBranch := m.disc.CurrentBranch
+		return m, m.suspend(string(flow), func() error {
+			return onboardingFunc(flow)(m.ctx, m.g, opts, m.user, currentBranch, m.stdout, opts.console.errOut())
+		})
+	default:
+		if msg.Type == tea.KeyRunes && w.field > 0 {
+			w.values[w.field] += string(msg.Runes)
+			w.stale = true
+		}
+	}
+	return m, nil
+}
+
+// wizardOptions turns the wizard inputs into onboarding options.
+func (m tuiModel) wizardOptions() options {
+	opts := m.opts
+	opts.twig = strings.TrimSpace(m.wizard.values[1])
+	opts.base = strings.TrimSpace(m.wizard.values[2])
+	opts.remote = strings.TrimSpace(m.wizard.values[3])
+	return opts
+}
+
+// onboardingFunc returns the run function behind an onboarding command.
+func onboardingFunc(flow command) func(context.Context, consensus.Git, options, string, string, io.Writer, io.Writer) error {
+	switch flow {
+	case cmdStart:
+		return runStart
+	case cmdJoin:
+		return runJoin
+	default:
+		return runInit
+	}
+}
+
+// wizardPlan returns the steps an onboarding command would show with --plan.
+func wizardPlan(ctx context.Context, g consensus.Git, flow command, opts options, user, currentBranch string) (string, []plannedStep, error) {
+	opts.plan = true
+	title, steps, err := planOnboarding(ctx, g, flow, opts, user, currentBranch)
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+	return title, steps, err
+}
+
+// planOnboarding evaluates flow's steps the way its --plan shows them.
+func planOnboarding(ctx context.Context, g consensus.Git, flow command, opts options, user, currentBranch string) (string, []plannedStep, error) {
+	if err := checkOnboardingTree(ctx, g, opts, io.Discard); err != nil {
+		return "", nil, err
+	}
+	if flow == cmdInit {
+		f, err := resolveInitFlow(ctx, g, opts, user, currentBranch, io.Discard)
+		if err != nil {
+			return "", nil, err
+		}
+		steps, err := f.plan(ctx, g, opts, currentBranch)
+		return f.title, steps, err
+	}
+	stepsFunc := startSteps
+	if flow == cmdJoin {
+		stepsFunc = joinSteps
+	}
+	title, steps, err := stepsFunc(ctx, g, opts, user, currentBranch, io.Discard)
+	if err != nil {
+		return "", nil, err
+	}
+	planned, err := planSteps(ctx, g, steps)
+	return title, planned, err
+}
+
+// suspend runs fn with the terminal handed back from the TUI, then waits for
+// Enter so its output can be read before the TUI redraws.
+func (m tuiModel) suspend(what string, fn func() error) tea.Cmd {
+	return tea.Exec(tuiExec{fn: fn, console: m.opts.console}, func(err error) tea.Msg {
+		return execDoneMsg{what: what, err: err}
+	})
+}
+
+// tuiExec adapts a function to tea.ExecCommand. The function uses the
+// console and stdout directly, which Bubble Tea releases while it runs.
+type tuiExec struct {
+	fn      func() error
+	console console
+}
+
+// Run implements tea.ExecCommand.
+func (e tuiExec) Run() error {
+	err := e.fn()
+	if err != nil {
+		printError(e.console.errOut(), err)
+	}
+	fmt.Fprint(e.console.errOut(), "\nPress Enter to return to mob-consensus tui...")
+	_, _ = promptString(e.console.in)
+	return err
+}
+
+// SetStdin implements tea.ExecCommand.
+func (tuiExec) SetStdin(io.Reader) {}
+
+// SetStdout implements tea.ExecCommand.
+func (tuiExec) SetStdout(io.Writer) {}
+
+// SetStderr implements tea.ExecCommand.
+func (tuiExec) SetStderr(io.Writer) {}
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true)
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	tuiHelpStyle     = lipgloss.NewStyle().Faint(true)
+	tuiErrorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	tuiBadgeStyles   = map[consensus.State]lipgloss.Style{
+		consensus.StateSynced:   lipgloss.NewStyle().Foreground(lipgloss.Color("2")),
+		consensus.StateAhead:    lipgloss.NewStyle().Foreground(lipgloss.Color("6")),
+		consensus.StateBehind:   lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		consensus.StateDiverged: lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true),
+	}
+)
+
+// badge renders a branch state as a fixed-width colored label.
+func badge(state consensus.State) string {
+	return tuiBadgeStyles[state].Render(fmt.Sprintf("%-10s", "["+string(state)+"]"))
+}
+
+// View implements tea.Model.
+func (m tuiModel) View() string {
+	var b strings.Builder
+	if m.view == tuiWizard {
+		m.viewWizard(&b)
+	} else {
+		m.viewBranches(&b)
+	}
+	if m.status != "" {
+		fmt.Fprintf(&b, "\n%s\n", m.status)
+	}
+	if m.err != nil {
+		fmt.Fprintf(&b, "\n%s\n", tuiErrorStyle.Render(m.err.Error()))
+	}
+	return b.String()
+}
+
+func (m tuiModel) viewBranches(b *strings.Builder) {
+	fmt.Fprintln(b, tuiTitleStyle.Render(fmt.Sprintf("mob-consensus: %s (twig %s)", m.disc.CurrentBranch, m.disc.Twig)))
+	fmt.Fprintln(b)
+	switch {
+	case !m.loaded:
+		fmt.Fprintln(b, "Loading related branches...")
+	case len(m.disc.Branches) == 0:
+		fmt.Fprintf(b, "No related */%s branches yet (press f to fetch).\n", m.disc.Twig)
+	default:
+		fmt.Fprintf(b, "  %-40s %-10s %s\n", "BRANCH", "STATE", "COMMITS (theirs/ours)")
+		for i, br := range m.disc.Branches {
+			line := fmt.Sprintf("%-40s %s +%d/-%d", br.Branch, badge(br.State()), br.AheadCommits, br.BehindCommits)
+			if br.Merge != nil && !br.Merge.Clean() {
+				line += fmt.Sprintf("  %s", countNoun(len(br.Merge.Conflicts), "conflict"))
+			}
+			if i == m.cursor {
+				line = tuiSelectedStyle.Render("> " + line)
+			} else {
+				line = "  " + line
+			}
+			fmt.Fprintln(b, line)
+		}
+	}
+	fmt.Fprintln(b)
+	// Only offer a merge when the selected branch has changes we lack.
+	help := "↑/↓ select · f fetch · r refresh · w onboarding · q quit"
+	if m.cursor < len(m.disc.Branches) && m.disc.Branches[m.cursor].NeedsMerge() {
+		help = "↑/↓ select · enter merge · f fetch · r refresh · w onboarding · q quit"
+	}
+	fmt.Fprintln(b, tuiHelpStyle.Render(help))
+}
+
+func (m tuiModel) viewWizard(b *strings.Builder) {
+	w := m.wizard
+	fmt.Fprintln(b, tuiTitleStyle.Render("mob-consensus onboarding"))
+	fmt.Fprintln(b)
+	placeholders := []string{"", "(from current branch)", "(current branch)", "(auto)"}
+	for i, name := range wizardFields {
+		value := w.values[i]
+		if i == 0 {
+			var flows []string
+			for j, flow := range wizardFlows {
+				if j == w.flow {
+					flows = append(flows, "< "+string(flow)+" >")
+				} else {
+					flows = append(flows, "  "+string(flow)+"  ")
+				}
+			}
+			value = strings.Join(flows, " ")
+		} else if value == "" && i != w.field {
+			value = tuiHelpStyle.Render(placeholders[i])
+		}
+		if i == w.field {
+			line := fmt.Sprintf("> %-7s %s", name+":", value)
+			if i > 0 {
+				line += "_"
+			}
+			fmt.Fprintln(b, line)
+		} else {
+			fmt.Fprintf(b, "  %-7s %s\n", name+":", value)
+		}
+	}
+	fmt.Fprintln(b)
+
+	switch {
+	case w.err != nil:
+		fmt.Fprintln(b, tuiErrorStyle.Render(w.err.Error()))
+	case w.stale:
+		fmt.Fprintln(b, "Press enter to preview the steps.")
+	default:
+		printPlan(b, w.title, w.steps)
+		fmt.Fprintln(b)
+		fmt.Fprintln(b, "Press enter to run these steps (you confirm each one in the terminal).")
+	}
+	fmt.Fprintln(b)
+	fmt.Fprintln(b, tuiHelpStyle.Render("tab/↑/↓ field · ←/→ flow · enter preview/run · esc back"))
+}
@@ -0,0 +1,337 @@
+package main
+
+// `mob-consensus twig`: commands that act on whole twigs.
+//
+// `twig list` groups every "<user>/<twig>" branch by twig, so you can see
+// which twigs exist and who is on them without reading `git branch -a`.
+//
+// `twig archive` cleans up after a finished twig. Once the consensus has
+// landed on the shared twig (see finish), the "<user>/<twig>" branches only
+// clutter `git branch -a`. archive tags the twig tip as archive/<twig>, so
+// the history stays reachable, then deletes the personal branches: local
+// ones, and remote ones on remotes the push policy lets us push to. It
+// refuses while any personal branch has commits the twig lacks. The shared
+// twig itself is left alone. Like finish, every git step goes through
+// runGitPlan, so --plan, --dry-run, and --yes work and a re-run skips what
+// is already done.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stevegt/mob-consensus/consensus"
+)
+
+// twigListSchemaVersion versions the `twig list --format json` document,
+// with the same compatibility rules as statusSchemaVersion.
+const twigListSchemaVersion = 1
+
+// twigListJSON is the `twig list --format json` document.
+type twigListJSON struct {
+	SchemaVersion int        `json:"schema_version"`
+	Twigs         []twigJSON `json:"twigs"`
+}
+
+// twigJSON describes one twig. LastActivity (RFC 3339) is the newest
+// committer date among its branches, and LastAuthor that commit's author.
+// SharedLocal and SharedRemotes tell where the shared twig branch exists.
+type twigJSON struct {
+	Twig          string           `json:"twig"`
+	Participants  []string         `json:"participants"`
+	Branches      []twigBranchJSON `json:"branches"`
+	LastActivity  string           `json:"last_activity"`
+	LastAuthor    string           `json:"last_author"`
+	SharedLocal   bool             `json:"shared_local"`
+	SharedRemotes []string         `json:"shared_remotes"`
+}
+
+// twigBranchJSON describes one personal branch of a twig.
+type twigBranchJSON struct {
+	Name   string `json:"name"`
+	Remote string `json:"remote"`
+	User   string `json:"user"`
+	Tip    string `json:"tip"`
+}
+
+// runTwigList implements `mob-consensus twig list`.
+func runTwigList(ctx context.Context, g consensus.Git, opts options, stdout io.Writer) error {
+	twigs, err := consensus.Runner{Git: g}.Twigs(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.format == formatJSON {
+		doc := twigListJSON{SchemaVersion: twigListSchemaVersion, Twigs: []twigJSON{}}
+		for _, t := range twigs {
+			tj := twigJSON{
+				Twig:          t.Twig,
+				Participants:  t.Users,
+				LastActivity:  formatJSONTime(t.LastActivity),
+				LastAuthor:    t.LastAuthor,
+				SharedLocal:   t.SharedLocal,
+				SharedRemotes: append([]string{}, t.SharedRemotes...),
+			}
+			for _, b := range t.Branches {
+				tj.Branches = append(tj.Branches, twigBranchJSON{Name: b.Branch, Remote: b.Remote, User: b.User, Tip: b.Tip})
+			}
+			doc.Twigs = append(doc.Twigs, tj)
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+
+	if len(twigs) == 0 {
+		fmt.Fprintln(stdout, "No twigs.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TWIG\tPARTICIPANTS\tBRANCHES\tLAST ACTIVITY\tSHARED TWIG")
+	now := time.Now()
+	for _, t := range twigs {
+		var shared []string
+		if t.SharedLocal {
+			shared = append(shared, "local")
+		}
+		shared = append(shared, t.SharedRemotes...)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s ago by %s\t%s\n", t.Twig, strings.Join(t.Users, ", "), len(t.Branches), formatAge(now.Sub(t.LastActivity)), t.LastAuthor, listOrNone(shared))
+	}
+	return tw.Flush()
+}
+
+// archiveTagPrefix names the tag twig archive creates (ex:
+// "archive/feature-x").
+const archiveTagPrefix = "archive/"
+
+// runTwigArchive implements `mob-consensus twig archive TWIG`.
+func runTwigArchive(ctx context.Context, g consensus.Git, opts options, twig, currentBranch string, stdout, stderr io.Writer) error {
+	if err := validateBranchName(ctx, g, "twig", twig); err != nil {
+		return usageError{Err: err}
+	}
+	repo := consensus.Runner{Git: g}
+	naming, err := repo.Naming(ctx)
+	if err != nil {
+		return err
+	}
+	remote, err := resolveRemote(ctx, g, cmdTwigArchive, opts, stderr)
+	if err != nil {
+		return usageError{Err: err}
+	}
+	twigRemote, err := resolveTwigRemote(ctx, g, remote)
+	if err != nil {
+		return err
+	}
+
+	// The consensus is the shared twig's tip: the local twig, else a
+	// remote-tracking copy.
+	source := ""
+	for _, ref := range []string{"refs/heads/" + twig, "refs/remotes/" + twigRemote + "/" + twig, "refs/remotes/" + remote + "/" + twig} {
+		exists, err := gitRefExists(ctx, g, ref)
+		if err != nil {
+			return err
+		}
+		if exists {
+			source = ref
+			break
+		}
+	}
+	if source == "" {
+		return fmt.Errorf("mob-consensus: shared twig %q not found locally or on %s (hint: land the consensus with `mob-consensus finish` first)", twig, twigRemote)
+	}
+	tip, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", source+"^{commit}")
+	if err != nil {
+		return err
+	}
+	tag := archiveTagPrefix + twig
+	tagged, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", "--quiet", "refs/tags/"+tag+"^{commit}")
+	if err == nil && tagged != tip {
+		return fmt.Errorf("mob-consensus: tag %s already exists at %s, not at the %s tip %s (hint: git tag -d %s if it is stale)", tag, shortSHA(tagged), twig, shortSHA(tip), tag)
+	}
+
+	branches, err := repo.TwigBranches(ctx, twig)
+	if err != nil {
+		return err
+	}
+	var unmerged []string
+	for _, b := range branches {
+		merged, err := repo.IsAncestor(ctx, b.Tip, tip)
+		if err != nil {
+			return err
+		}
+		if merged {
+			continue
+		}
+		out, err := gitOutputTrimmed(ctx, g, "rev-list", "--count", tip+".."+b.Tip)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(out)
+		if err != nil {
+			return err
+		}
+		unmerged = append(unmerged, fmt.Sprintf("%s (%s)", b.Branch, countNoun(n, "commit")))
+	}
+	if len(unmerged) > 0 {
+		return fmt.Errorf("mob-consensus: refusing to archive %s; not merged into %s: %s (hint: merge them, run `mob-consensus finish`, then archive again)", twig, strings.TrimPrefix(strings.TrimPrefix(source, "refs/heads/"), "refs/"), strings.Join(unmerged, ", "))
+	}
+
+	policy, err := repo.Policy(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		local      []string
+		onRemote   = map[string][]string{}
+		remotes    []string
+		kept       []string
+		checkedOut string
+	)
+	for _, b := range branches {
+		switch {
+		case b.Remote == "" && b.Branch == currentBranch:
+			// --plan and --dry-run only print the steps; a real run can't
+			// delete the branch it is on.
+			if !opts.plan && !opts.dryRun {
+				return usageError{Err: fmt.Errorf("mob-consensus: can't delete %s while it is checked out (hint: git checkout %s)", b.Branch, twig)}
+			}
+			checkedOut = b.Branch
+			local = append(local, b.Branch)
+		case b.Remote == "":
+			local = append(local, b.Branch)
+		case policy.CheckPush(b.Remote) != nil:
+			kept = append(kept, fmt.Sprintf("%s (pushes go to %s only)", b.Branch, policy.PushRemote))
+		default:
+			if len(onRemote[b.Remote]) == 0 {
+				remotes = append(remotes, b.Remote)
+			}
+			onRemote[b.Remote] = append(onRemote[b.Remote], b.Name())
+		}
+	}
+
+	// existing returns the names whose ref (built by ref) still exists.
+	existing := func(ctx context.Context, names []string, ref func(string) string) ([]string, error) {
+		var out []string
+		for _, name := range names {
+			exists, err := gitRefExists(ctx, g, ref(name))
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				out = append(out, name)
+			}
+		}
+		return out, nil
+	}
+	// deleted returns a Done check: satisfied once no ref is left.
+	deleted := func(names []string, ref func(string) string) func(ctx context.Context) (string, error) {
+		return func(ctx context.Context) (string, error) {
+			left, err := existing(ctx, names, ref)
+			if err != nil || len(left) > 0 {
+				return "", err
+			}
+			return "already deleted", nil
+		}
+	}
+	localRef := func(name string) string { return "refs/heads/" + name }
+
+	steps := []gitPlanStep{
+		{
+			Explain: fmt.Sprintf("Tag the %s tip as %q", twig, tag),
+			Args: func(ctx context.Context) ([]string, error) {
+				return []string{"tag", "-a", "-m", "mob-consensus: archive of twig " + twig, tag, tip}, nil
+			},
+			Done: func(ctx context.Context) (string, error) {
+				if exists, err := gitRefExists(ctx, g, "refs/tags/"+tag); err != nil || !exists {
+					return "", err
+				}
+				return fmt.Sprintf("%s already exists at %s", tag, shortSHA(tip)), nil
+			},
+		},
+		{
+			Explain: fmt.Sprintf("Push tag %q", tag),
+			Args: func(ctx context.Context) ([]string, error) {
+				return []string{"push", remote, "refs/tags/" + tag}, nil
+			},
+			Done: func(ctx context.Context) (string, error) {
+				local, err := gitOutputTrimmed(ctx, g, "rev-parse", "--verify", "--quiet", "refs/tags/"+tag)
+				if err != nil {
+					return "", nil
+				}
+				// A failed lookup (ex: offline) just means pushing again.
+				pushed, err := gitOutputTrimmed(ctx, g, "ls-remote", remote, "refs/tags/"+tag)
+				if err != nil || !strings.HasPrefix(pushed, local+"\t") {
+					return "", nil
+				}
+				return fmt.Sprintf("%s is on %s", tag, remote), nil
+			},
+		},
+	}
+	if len(local) > 0 {
+		steps = append(steps, gitPlanStep{
+			Explain: fmt.Sprintf("Delete the local %s branches", naming.Branch("<user>", twig)),
+			Args: func(ctx context.Context) ([]string, error) {
+				left, err := existing(ctx, local, localRef)
+				if err != nil {
+					return nil, err
+				}
+				return append([]string{"branch", "-D"}, left...), nil
+			},
+			Done: deleted(local, localRef),
+		})
+	}
+	for _, r := range remotes {
+		names := onRemote[r]
+		trackingRef := func(name string) string { return "refs/remotes/" + r + "/" + name }
+		steps = append(steps, gitPlanStep{
+			Explain: fmt.Sprintf("Delete the %s branches on %s", naming.Branch("<user>", twig), r),
+			Args: func(ctx context.Context) ([]string, error) {
+				left, err := existing(ctx, names, trackingRef)
+				if err != nil {
+					return nil, err
+				}
+				return append([]string{"push", r, "--delete"}, left...), nil
+			},
+			Done:     deleted(names, trackingRef),
+			Optional: true,
+		})
+	}
+
+	title := fmt.Sprintf("mob-consensus twig archive (twig=%s, tip=%s, %s)", twig, shortSHA(tip), remoteLabel(remote, twigRemote))
+	if err := runGitPlan(ctx, g, opts, title, steps, stdout, stderr); err != nil {
+		return err
+	}
+	if opts.dryRun {
+		return nil
+	}
+	if opts.plan {
+		if len(kept) > 0 {
+			fmt.Fprintf(stdout, "\nWon't delete:\n  %s\n", strings.Join(kept, "\n  "))
+		}
+		if checkedOut != "" {
+			fmt.Fprintf(stdout, "\nNote: %s is checked out; switch away first (git checkout %s).\n", checkedOut, twig)
+		}
+		return nil
+	}
+
+	// Report what is left: branches the policy kept, plus deletions that
+	// failed (ex: the remote refused them).
+	for _, b := range branches {
+		if b.Remote == "" || policy.CheckPush(b.Remote) == nil {
+			if exists, err := gitRefExists(ctx, g, b.Ref()); err != nil {
+				return err
+			} else if exists {
+				kept = append(kept, fmt.Sprintf("%s (still exists; see the error above)", b.Branch))
+			}
+		}
+	}
+	fmt.Fprintf(stdout, "\nArchived %s as tag %s (%s).\n", twig, tag, shortSHA(tip))
+	if len(kept) > 0 {
+		fmt.Fprintf(stdout, "Couldn't delete:\n  %s\n", strings.Join(kept, "\n  "))
+	}
+	return nil
+}